@@ -0,0 +1,367 @@
+package cli
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"github.com/ixday/antfarm"
+	"io"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+const (
+	ExitOK        = 0
+	ExitFailure   = 1   // a task failed
+	ExitUsage     = 2   // invalid command line
+	ExitGraph     = 3   // missing dependency or cycle in the tasks
+	ExitTimeout   = 124 // a task or the whole run timed out, as timeout(1) does
+	ExitInterrupt = 130 // aborted by a signal, as shells do for SIGINT
+)
+
+type (
+	Opts struct {
+		Name   string // program name, used in the usage and the completion scripts
+		Stdout io.Writer
+		Stderr io.Writer
+	}
+
+	cli struct {
+		Opts
+		runner antfarm.Runner
+	}
+)
+
+var commands = []string{"list", "run", "watch", "describe", "graph", "completion", "help"}
+
+// Main runs the command line of the program and exits with the resulting code
+func Main(runner antfarm.Runner, options ...func(*Opts)) {
+	os.Exit(Run(runner, os.Args[1:], options...))
+}
+
+// Run executes the command described by args and returns the exit code
+func Run(runner antfarm.Runner, args []string, options ...func(*Opts)) int {
+	c := cli{Opts{filepath.Base(os.Args[0]), os.Stdout, os.Stderr}, runner}
+	for _, option := range options {
+		option(&c.Opts)
+	}
+	if len(args) == 0 {
+		c.usage()
+		return ExitUsage
+	}
+
+	switch args[0] {
+	case "list":
+		return c.list(args[1:])
+	case "run":
+		return c.run(args[1:])
+	case "watch":
+		return c.watch(args[1:])
+	case "describe":
+		return c.describe(args[1:])
+	case "graph":
+		return c.graph(args[1:])
+	case "completion":
+		return c.completion(args[1:])
+	case "help", "-h", "-help", "--help":
+		c.usage()
+		return ExitOK
+	}
+	fmt.Fprintf(c.Stderr, "unknown command: %s\n", args[0])
+	c.usage()
+	return ExitUsage
+}
+
+func (c cli) usage() {
+	fmt.Fprintf(c.Stderr, `Usage: %[1]s <command> [arguments]
+
+Commands:
+  list [flags]                  list the tasks and their description
+  run [flags] [targets...]      run the targets and their dependencies
+  watch [flags] targets...      run the targets, then again when the inputs of their tasks change
+  describe <task>               show the details of a task
+  graph [-format f] [targets]   print the dependency graph, format is dot or mermaid
+  completion <bash|zsh>         print the shell completion script
+
+Run "%[1]s <command> -h" for the flags of a command.
+`, c.Name)
+}
+
+func (c cli) flags(name string) *flag.FlagSet {
+	fs := flag.NewFlagSet(c.Name+" "+name, flag.ContinueOnError)
+	fs.SetOutput(c.Stderr)
+	return fs
+}
+
+// exit converts the error of a run or a resolution into an exit code
+func (c cli) exit(err error) int {
+	if err == nil {
+		return ExitOK
+	}
+	fmt.Fprintf(c.Stderr, "%s: %s\n", c.Name, err)
+	cause := err
+	var errs antfarm.TaskErrors
+	if errors.As(err, &errs) { // the tasks canceled along the way do not tell why the run failed
+		cause = errs.Causes()
+	}
+	switch {
+	case errors.Is(cause, antfarm.ErrDepNotFound), errors.Is(cause, antfarm.ErrDepCircular), errors.Is(cause, antfarm.ErrReserved):
+		return ExitGraph
+	case errors.Is(cause, antfarm.ErrInterrupt), canceled(cause):
+		return ExitInterrupt
+	case errors.Is(cause, antfarm.ErrTimeout):
+		return ExitTimeout
+	}
+	return ExitFailure
+}
+
+// canceled tells if the run was stopped by the cancellation of its own context, not by a task
+func canceled(err error) bool {
+	errs, ok := err.(antfarm.TaskErrors)
+	if !ok {
+		return errors.Is(err, context.Canceled)
+	}
+	for _, e := range errs {
+		if e.Internal() && errors.Is(e, context.Canceled) {
+			return true
+		}
+	}
+	return false
+}
+
+func (c cli) list(args []string) int {
+	fs := c.flags("list")
+	names := fs.Bool("names", false, "only print the names of the tasks")
+	all := fs.Bool("all", false, "include the hidden tasks")
+	tag := fs.String("tag", "", "only list the tasks having the tag")
+	if err := fs.Parse(args); err != nil {
+		return ExitUsage
+	}
+
+	w := tabwriter.NewWriter(c.Stdout, 0, 4, 2, ' ', 0)
+	for _, node := range c.runner.Nodes() {
+		if node.Hidden && !*all || *tag != "" && !node.HasTag(*tag) {
+			continue
+		}
+		if *names {
+			fmt.Fprintln(w, node.Name)
+			continue
+		}
+		description := node.Description
+		if len(node.Tags) > 0 {
+			description += fmt.Sprintf(" [%s]", strings.Join(node.Tags, ", "))
+		}
+		fmt.Fprintf(w, "%s\t%s\n", node.Name, strings.TrimSpace(description))
+	}
+	w.Flush()
+	return ExitOK
+}
+
+func (c cli) run(args []string) int {
+	runner := c.runner
+	fs := c.flags("run")
+	fs.IntVar(&runner.Jobs, "j", runner.Jobs, "maximum number of tasks running at once, unlimited if 0")
+	fs.BoolVar(&runner.KeepGoing, "k", runner.KeepGoing, "keep going on failure, only skip the dependents")
+	fs.DurationVar(&runner.Timeout, "timeout", runner.Timeout, "maximum duration of the run")
+	fs.BoolVar(&runner.Transactional, "rollback", runner.Transactional, "undo the applied provisioners if the run fails")
+	dryRun := fs.Bool("dry-run", false, "print the execution plan without running anything")
+	verbose := fs.Bool("v", false, "print the task events")
+	tag := fs.String("tag", "", "run the tasks having the tag along with the targets")
+	if err := fs.Parse(args); err != nil {
+		return ExitUsage
+	}
+	targets := fs.Args()
+	if *tag != "" {
+		targets = append(targets, runner.Tagged(*tag)...)
+	}
+	if len(targets) == 0 {
+		fmt.Fprintln(c.Stderr, "no target to run")
+		return ExitUsage
+	}
+
+	if *dryRun {
+		plan, err := runner.Plan(targets...)
+		if err != nil {
+			return c.exit(err)
+		}
+		fmt.Fprint(c.Stdout, plan)
+		return ExitOK
+	}
+	if *verbose {
+		runner.Listeners = append([]antfarm.Listener{antfarm.ListenerFunc(c.log)}, runner.Listeners...)
+	}
+	return c.exit(runner.Start(targets...))
+}
+
+func (c cli) watch(args []string) int {
+	runner := c.runner
+	fs := c.flags("watch")
+	fs.IntVar(&runner.Jobs, "j", runner.Jobs, "maximum number of tasks running at once, unlimited if 0")
+	fs.BoolVar(&runner.KeepGoing, "k", runner.KeepGoing, "keep going on failure, only skip the dependents")
+	opts := antfarm.WatchOpts{}
+	fs.DurationVar(&opts.Debounce, "debounce", 100*time.Millisecond, "quiet period awaited after a change")
+	fs.BoolVar(&opts.Poll, "poll", false, "poll the files instead of relying on the system notifications")
+	verbose := fs.Bool("v", false, "print the task events")
+	if err := fs.Parse(args); err != nil {
+		return ExitUsage
+	}
+	if fs.NArg() == 0 {
+		fmt.Fprintln(c.Stderr, "no target to watch")
+		return ExitUsage
+	}
+	if *verbose {
+		runner.Listeners = append([]antfarm.Listener{antfarm.ListenerFunc(c.log)}, runner.Listeners...)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	err := runner.Watch(ctx, fs.Args(), func(o *antfarm.WatchOpts) {
+		o.Debounce, o.Poll = opts.Debounce, opts.Poll
+		o.Done = func(report antfarm.Report, err error) {
+			if err != nil {
+				fmt.Fprintf(c.Stderr, "%s: %s\n", c.Name, err)
+			}
+			fmt.Fprintf(c.Stderr, "%d succeeded, %d failed, %d skipped, watching for changes...\n",
+				len(report.Succeeded), len(report.Failed), len(report.Skipped))
+		}
+	})
+	if errors.Is(err, context.Canceled) { // interrupted, the usual way out
+		return ExitInterrupt
+	}
+	return c.exit(err)
+}
+
+func (c cli) log(e antfarm.Event) {
+	switch e.Kind {
+	case antfarm.Queued:
+	case antfarm.Started:
+		fmt.Fprintf(c.Stderr, "[%s] %s\n", e.Kind, e.Task)
+	case antfarm.Failed, antfarm.Cancelled:
+		fmt.Fprintf(c.Stderr, "[%s] %s after %s: %s\n", e.Kind, e.Task, e.Duration.Round(time.Millisecond), e.Err)
+	case antfarm.Undone:
+		if e.Err != nil {
+			fmt.Fprintf(c.Stderr, "[%s] %s: %s\n", e.Kind, e.Task, e.Err)
+		} else {
+			fmt.Fprintf(c.Stderr, "[%s] %s\n", e.Kind, e.Task)
+		}
+	default:
+		fmt.Fprintf(c.Stderr, "[%s] %s after %s\n", e.Kind, e.Task, e.Duration.Round(time.Millisecond))
+	}
+}
+
+func (c cli) describe(args []string) int {
+	fs := c.flags("describe")
+	if err := fs.Parse(args); err != nil {
+		return ExitUsage
+	}
+	if fs.NArg() != 1 {
+		fmt.Fprintln(c.Stderr, "describe expects a single task")
+		return ExitUsage
+	}
+	node, ok := c.runner.Lookup(fs.Arg(0))
+	if !ok {
+		fmt.Fprintf(c.Stderr, "unknown task: %s\n", fs.Arg(0))
+		return ExitUsage
+	}
+	order, err := c.runner.Resolve(node)
+	if err != nil {
+		return c.exit(err)
+	}
+
+	w := tabwriter.NewWriter(c.Stdout, 0, 4, 1, ' ', 0)
+	fmt.Fprintf(w, "name:\t%s\n", node.Name)
+	if node.Description != "" {
+		fmt.Fprintf(w, "description:\t%s\n", node.Description)
+	}
+	if len(node.Tags) > 0 {
+		fmt.Fprintf(w, "tags:\t%s\n", strings.Join(node.Tags, ", "))
+	}
+	if node.Hidden {
+		fmt.Fprintln(w, "hidden:\ttrue")
+	}
+	fmt.Fprintf(w, "deps:\t%s\n", strings.Join(node.Deps, ", "))
+	fmt.Fprintf(w, "order:\t%s\n", strings.Join(order, ", "))
+	fmt.Fprintf(w, "weight:\t%d\n", node.Weight)
+	if len(node.Resources) > 0 {
+		fmt.Fprintf(w, "resources:\t%s\n", strings.Join(node.Resources, ", "))
+	}
+	if node.Timeout > 0 {
+		fmt.Fprintf(w, "timeout:\t%s\n", node.Timeout)
+	}
+	if len(node.Inputs) > 0 {
+		fmt.Fprintf(w, "inputs:\t%s\n", strings.Join(node.Inputs, ", "))
+	}
+	if len(node.Outputs) > 0 {
+		fmt.Fprintf(w, "outputs:\t%s\n", strings.Join(node.Outputs, ", "))
+	}
+	if node.Retry.Attempts > 1 {
+		fmt.Fprintf(w, "attempts:\t%d\n", node.Retry.Attempts)
+	}
+	keys := make([]string, 0, len(node.Annotations))
+	for key := range node.Annotations {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		fmt.Fprintf(w, "%s:\t%s\n", key, node.Annotations[key])
+	}
+	w.Flush()
+	return ExitOK
+}
+
+func (c cli) graph(args []string) int {
+	fs := c.flags("graph")
+	format := fs.String("format", "dot", "output format, dot or mermaid")
+	if err := fs.Parse(args); err != nil {
+		return ExitUsage
+	}
+
+	targets := func(opts *antfarm.GraphOpts) { opts.Targets = fs.Args() }
+	switch *format {
+	case "dot":
+		return c.exit(c.runner.DOT(c.Stdout, targets))
+	case "mermaid":
+		return c.exit(c.runner.Mermaid(c.Stdout, targets))
+	}
+	fmt.Fprintf(c.Stderr, "unknown format: %s\n", *format)
+	return ExitUsage
+}
+
+func (c cli) completion(args []string) int {
+	if len(args) != 1 {
+		fmt.Fprintln(c.Stderr, "completion expects a shell, bash or zsh")
+		return ExitUsage
+	}
+	function := "_" + strings.Map(func(r rune) rune {
+		if r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' {
+			return r
+		}
+		return '_'
+	}, c.Name)
+
+	switch args[0] {
+	case "zsh":
+		fmt.Fprintln(c.Stdout, "autoload -U +X bashcompinit && bashcompinit")
+	case "bash":
+	default:
+		fmt.Fprintf(c.Stderr, "unsupported shell: %s\n", args[0])
+		return ExitUsage
+	}
+	fmt.Fprintf(c.Stdout, `%[1]s() {
+	local cur="${COMP_WORDS[COMP_CWORD]}"
+	if [ "$COMP_CWORD" -eq 1 ]; then
+		COMPREPLY=($(compgen -W "%[3]s" -- "$cur"))
+	else
+		COMPREPLY=($(compgen -W "$(%[2]s list -names 2>/dev/null)" -- "$cur"))
+	fi
+}
+complete -F %[1]s %[2]s
+`, function, c.Name, strings.Join(commands, " "))
+	return ExitOK
+}
@@ -0,0 +1,152 @@
+package cli
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"github.com/ixday/antfarm"
+	"strings"
+	"testing"
+	"time"
+)
+
+func noop() antfarm.Task { return antfarm.TaskFunc(func(_ context.Context) error { return nil }) }
+
+func helperRun(t *testing.T, runner antfarm.Runner, args ...string) (int, string, string) {
+	t.Helper()
+	var stdout, stderr bytes.Buffer
+	code := Run(runner, args, func(opts *Opts) {
+		opts.Name, opts.Stdout, opts.Stderr = "farm", &stdout, &stderr
+	})
+	return code, stdout.String(), stderr.String()
+}
+
+func testRunner() antfarm.Runner {
+	return antfarm.Runner{}.
+		Add(antfarm.Node{Name: "foo", Task: noop(), Hidden: true}).
+		Add(antfarm.Node{Name: "bar", Task: noop(), Deps: []string{"foo"}, Description: "build bar", Tags: []string{"ci"}}).
+		Add(antfarm.Node{Name: "baz", Task: noop(), Deps: []string{"bar"}, Timeout: time.Second,
+			Description: "deploy baz", Annotations: map[string]string{"owner": "ops"}})
+}
+
+func TestList(t *testing.T) {
+	code, stdout, _ := helperRun(t, testRunner(), "list")
+	expected := "bar  build bar [ci]\nbaz  deploy baz\n"
+	if code != ExitOK || stdout != expected {
+		t.Errorf("unexpected output, got: %d %q, expected: %q", code, stdout, expected)
+	}
+
+	if _, stdout, _ = helperRun(t, testRunner(), "list", "-names", "-all"); stdout != "bar\nbaz\nfoo\n" {
+		t.Errorf("unexpected output, got: %q", stdout)
+	}
+	if _, stdout, _ = helperRun(t, testRunner(), "list", "-names", "-tag", "ci"); stdout != "bar\n" {
+		t.Errorf("unexpected output, got: %q", stdout)
+	}
+}
+
+func TestRunTag(t *testing.T) {
+	code, stdout, _ := helperRun(t, testRunner(), "run", "-dry-run", "-tag", "ci")
+	expected := "wave 1:\n  run foo: no expectation\nwave 2:\n  run bar: no expectation\n"
+	if code != ExitOK || stdout != expected {
+		t.Errorf("unexpected output, got: %d %q, expected: %q", code, stdout, expected)
+	}
+}
+
+func TestRun(t *testing.T) {
+	code, _, stderr := helperRun(t, testRunner(), "run", "-v", "-j", "1", "baz")
+	if code != ExitOK {
+		t.Errorf("unexpected exit code, got: %d, expected: %d", code, ExitOK)
+	}
+	for _, name := range []string{"foo", "bar", "baz"} {
+		if !strings.Contains(stderr, "[started] "+name+"\n") || !strings.Contains(stderr, "[succeeded] "+name+" after") {
+			t.Errorf("verbose output should log task %s, got: %q", name, stderr)
+		}
+	}
+}
+
+func TestRunDryRun(t *testing.T) {
+	code, stdout, _ := helperRun(t, testRunner(), "run", "-dry-run", "bar")
+	expected := "wave 1:\n  run foo: no expectation\nwave 2:\n  run bar: no expectation\n"
+	if code != ExitOK || stdout != expected {
+		t.Errorf("unexpected output, got: %d %q, expected: %q", code, stdout, expected)
+	}
+}
+
+func TestRunExitCodes(t *testing.T) {
+	for expected, task := range map[int]antfarm.Task{
+		ExitFailure: antfarm.TaskFunc(func(_ context.Context) error { return errors.New("foo") }),
+		ExitTimeout: antfarm.TaskFunc(func(ctx context.Context) error {
+			<-ctx.Done()
+			return ctx.Err()
+		}),
+	} {
+		runner := antfarm.Runner{}.Add(antfarm.Node{Name: "foo", Task: task, Timeout: time.Millisecond})
+		if code, _, _ := helperRun(t, runner, "run", "foo"); code != expected {
+			t.Errorf("unexpected exit code, got: %d, expected: %d", code, expected)
+		}
+	}
+
+	// a sibling returning the error of its canceled context does not hide the cause
+	sibling := antfarm.TaskFunc(func(ctx context.Context) error {
+		<-ctx.Done()
+		return ctx.Err()
+	})
+	for expected, node := range map[int]antfarm.Node{
+		ExitFailure: {Name: "foo", Task: antfarm.TaskFunc(func(_ context.Context) error { return errors.New("boom") })},
+		ExitTimeout: {Name: "foo", Task: sibling, Timeout: time.Millisecond},
+	} {
+		runner := antfarm.Runner{}.Add(node).Add(antfarm.Node{Name: "bar", Task: sibling})
+		if code, _, _ := helperRun(t, runner, "run", "foo", "bar"); code != expected {
+			t.Errorf("unexpected exit code, got: %d, expected: %d", code, expected)
+		}
+	}
+
+	if code, _, _ := helperRun(t, testRunner(), "run", "qux"); code != ExitGraph {
+		t.Errorf("unexpected exit code, got: %d, expected: %d", code, ExitGraph)
+	}
+	if code, _, _ := helperRun(t, testRunner(), "run"); code != ExitUsage {
+		t.Errorf("unexpected exit code, got: %d, expected: %d", code, ExitUsage)
+	}
+	if code, _, _ := helperRun(t, testRunner(), "unknown"); code != ExitUsage {
+		t.Errorf("unexpected exit code, got: %d, expected: %d", code, ExitUsage)
+	}
+}
+
+func TestDescribe(t *testing.T) {
+	code, stdout, _ := helperRun(t, testRunner(), "describe", "baz")
+	expected := "name:        baz\ndescription: deploy baz\ndeps:        bar\norder:       foo, bar, baz\n" +
+		"weight:      1\ntimeout:     1s\nowner:       ops\n"
+	if code != ExitOK || stdout != expected {
+		t.Errorf("unexpected output, got: %d %q, expected: %q", code, stdout, expected)
+	}
+	if code, _, _ := helperRun(t, testRunner(), "describe", "qux"); code != ExitUsage {
+		t.Errorf("unexpected exit code, got: %d, expected: %d", code, ExitUsage)
+	}
+}
+
+func TestGraph(t *testing.T) {
+	code, stdout, _ := helperRun(t, testRunner(), "graph", "-format", "mermaid", "bar")
+	expected := "flowchart LR\n\tn0[\"foo\"]\n\tn1[\"bar\"]\n\tn0 --> n1\n"
+	if code != ExitOK || stdout != expected {
+		t.Errorf("unexpected output, got: %d %q, expected: %q", code, stdout, expected)
+	}
+}
+
+func TestCompletion(t *testing.T) {
+	code, stdout, _ := helperRun(t, testRunner(), "completion", "bash")
+	if code != ExitOK || !strings.Contains(stdout, "complete -F _farm farm\n") {
+		t.Errorf("unexpected completion script, got: %q", stdout)
+	}
+	if code, _, _ := helperRun(t, testRunner(), "completion", "fish"); code != ExitUsage {
+		t.Errorf("unexpected exit code, got: %d, expected: %d", code, ExitUsage)
+	}
+}
+
+func TestWatchUsage(t *testing.T) {
+	if code, _, _ := helperRun(t, testRunner(), "watch"); code != ExitUsage {
+		t.Errorf("unexpected exit code, got: %d, expected: %d", code, ExitUsage)
+	}
+	if code, _, _ := helperRun(t, testRunner(), "watch", "qux"); code != ExitGraph {
+		t.Errorf("unexpected exit code, got: %d, expected: %d", code, ExitGraph)
+	}
+}
@@ -0,0 +1,137 @@
+package antfarm
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+type (
+	DependencyNotFoundError struct {
+		Task    string   // task declaring the dependencies, empty for a target
+		Missing []string // dependencies not registered in the runner
+	}
+
+	// DependencyErrors gathers every missing dependency found during resolution
+	DependencyErrors []*DependencyNotFoundError
+
+	CycleError struct {
+		Path []string // tasks forming the loop, first and last elements are equal
+	}
+
+	TimeoutError struct {
+		Task    string // empty when the whole run timed out
+		Timeout time.Duration
+		Err     error // returned by the task once its context expired
+	}
+
+	TaskError struct {
+		Name      string
+		Err       error
+		Cancelled bool // failed while being canceled by the runner
+	}
+
+	// TaskErrors lists every task which failed during a run, in order of failure
+	TaskErrors []*TaskError
+)
+
+func (e *DependencyNotFoundError) Error() string {
+	if e.Task == "" {
+		return fmt.Sprintf("%s: %s", ErrDepNotFound, strings.Join(e.Missing, ", "))
+	}
+	return fmt.Sprintf("%s: %s required by %s", ErrDepNotFound, strings.Join(e.Missing, ", "), e.Task)
+}
+
+func (e *DependencyNotFoundError) Is(target error) bool { return target == ErrDepNotFound }
+
+func (e DependencyErrors) Error() string {
+	messages := make([]string, len(e))
+	for i, err := range e {
+		messages[i] = err.Error()
+	}
+	return strings.Join(messages, "; ")
+}
+
+func (e DependencyErrors) Is(target error) bool { return target == ErrDepNotFound }
+
+func (e DependencyErrors) Unwrap() []error {
+	errs := make([]error, len(e))
+	for i, err := range e {
+		errs[i] = err
+	}
+	return errs
+}
+
+func (e *CycleError) Error() string {
+	return fmt.Sprintf("%s: %s", ErrDepCircular, strings.Join(e.Path, " -> "))
+}
+
+func (e *CycleError) Is(target error) bool { return target == ErrDepCircular }
+
+func (e *TimeoutError) Error() string {
+	if e.Task == "" {
+		return fmt.Sprintf("run %s after %s", ErrTimeout, e.Timeout)
+	}
+	return fmt.Sprintf("%s after %s: %s", ErrTimeout, e.Timeout, e.Err)
+}
+
+func (e *TimeoutError) Is(target error) bool { return target == ErrTimeout }
+func (e *TimeoutError) Unwrap() error        { return e.Err }
+
+func (e *TaskError) Error() string {
+	if e.Cancelled {
+		return fmt.Sprintf("task %s (canceled): %s", e.Name, e.Err)
+	}
+	return fmt.Sprintf("task %s: %s", e.Name, e.Err)
+}
+
+func (e *TaskError) Unwrap() error { return e.Err }
+
+// Internal tells if the failure comes from the runner itself, its interruption, timeout or state
+func (e *TaskError) Internal() bool { return reserved(e.Name) }
+
+func (e TaskErrors) Error() string {
+	messages := make([]string, len(e))
+	for i, err := range e {
+		messages[i] = err.Error()
+	}
+	return strings.Join(messages, "; ")
+}
+
+// Causes drops the failures of the tasks canceled by the runner, they only follow from the other ones
+func (e TaskErrors) Causes() TaskErrors {
+	var causes TaskErrors
+	for _, err := range e {
+		if !err.Cancelled {
+			causes = append(causes, err)
+		}
+	}
+	return causes
+}
+
+func (e TaskErrors) Is(target error) bool {
+	for _, err := range e {
+		if errors.Is(err, target) {
+			return true
+		}
+	}
+	return false
+}
+
+func (e TaskErrors) As(target interface{}) bool {
+	for _, err := range e {
+		if errors.As(err, target) {
+			return true
+		}
+	}
+	return false
+}
+
+func (e TaskErrors) Unwrap() []error {
+	errs := make([]error, len(e))
+	for i, err := range e {
+		errs[i] = err
+	}
+	return errs
+}
@@ -0,0 +1,102 @@
+package antfarm
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+const (
+	Queued    EventKind = iota // dependencies completed, waiting for slots and resources
+	Started                    // duration is the time spent queued
+	Succeeded                  // duration is the running time, same for the following kinds
+	Failed
+	Cancelled // canceled by the runner, before or while running
+	Skipped   // a dependency did not succeed
+	Satisfied // nothing to do, the provisioner expectation is already met
+	Undone    // rolled back after the run failed, err set when it could not be
+)
+
+type (
+	EventKind int
+
+	Event struct {
+		Task     string
+		Kind     EventKind
+		Time     time.Time
+		Duration time.Duration
+		Err      error // set for failed and cancelled tasks, and failed rollbacks
+	}
+
+	// Listener receives the events of a run, one call at a time
+	Listener interface {
+		Event(Event)
+	}
+
+	ListenerFunc func(Event)
+
+	reporterKey struct{}
+	reporter    func(EventKind)
+	nameKey     struct{}
+	sharedKey   struct{}
+
+	// shared holds the values the tasks of a run share, dropped with the run
+	shared struct {
+		sync.Mutex
+		values map[interface{}]interface{}
+	}
+)
+
+func (lf ListenerFunc) Event(e Event) { lf(e) }
+
+func (k EventKind) String() string {
+	switch k {
+	case Queued:
+		return "queued"
+	case Started:
+		return "started"
+	case Succeeded:
+		return "succeeded"
+	case Failed:
+		return "failed"
+	case Cancelled:
+		return "cancelled"
+	case Skipped:
+		return "skipped"
+	case Satisfied:
+		return "satisfied"
+	case Undone:
+		return "undone"
+	}
+	return "unknown"
+}
+
+// TaskName returns the name of the node a task is started for, false when not started by a run
+func TaskName(ctx context.Context) (string, bool) {
+	name, ok := ctx.Value(nameKey{}).(string)
+	return name, ok
+}
+
+// Shared returns the value the tasks of a run share under key, created by init on first use and dropped with the run.
+// Outside of a run, every call gets a new value.
+func Shared(ctx context.Context, key interface{}, init func() interface{}) interface{} {
+	s, ok := ctx.Value(sharedKey{}).(*shared)
+	if !ok {
+		return init()
+	}
+	s.Lock()
+	defer s.Unlock()
+	value, ok := s.values[key]
+	if !ok {
+		value = init()
+		s.values[key] = value
+	}
+	return value
+}
+
+// emit lets tasks started by a run report events for their node
+func emit(ctx context.Context, kind EventKind) {
+	if r, ok := ctx.Value(reporterKey{}).(reporter); ok {
+		r(kind)
+	}
+}
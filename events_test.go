@@ -0,0 +1,90 @@
+package antfarm
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+type recorder []string
+
+func (r *recorder) Event(e Event) { *r = append(*r, fmt.Sprintf("%s %s", e.Task, e.Kind)) }
+
+func TestEvents(t *testing.T) {
+	events := &recorder{}
+	ErrBar := fmt.Errorf("bar")
+
+	Runner{KeepGoing: true, Listeners: []Listener{events}}.
+		Task("foo", noop()).
+		Task("bar", Error(ErrBar), "foo").
+		Task("baz", noop(), "bar").
+		Task("qux", Provision(NewMockProvisioner(func(mp *MockProvisioner) { mp.ExpectOk = false })), "foo").
+		Start("baz", "qux")
+
+	expected := map[string][]string{
+		"foo": {"foo queued", "foo started", "foo succeeded"},
+		"bar": {"bar queued", "bar started", "bar failed"},
+		"baz": {"baz skipped"},
+		"qux": {"qux queued", "qux started", "qux satisfied", "qux succeeded"},
+	}
+	for name, kinds := range expected {
+		var got []string
+		for _, event := range *events {
+			if strings.HasPrefix(event, name+" ") {
+				got = append(got, event)
+			}
+		}
+		compare(t, got, kinds)
+	}
+}
+
+func TestEventsDuration(t *testing.T) {
+	var events []Event
+	Runner{Listeners: []Listener{ListenerFunc(func(e Event) { events = append(events, e) })}}.
+		Task("foo", noop()).
+		Start("foo")
+
+	if len(events) != 3 {
+		t.Fatalf("unexpected number of events, got: %d", len(events))
+	}
+	for i, event := range events[1:] {
+		if event.Time.Before(events[i].Time) {
+			t.Errorf("events should be ordered, got: %s before %s", events[i].Kind, event.Kind)
+		}
+	}
+	if last := events[2]; last.Kind != Succeeded || last.Duration < 0 || last.Duration > last.Time.Sub(events[0].Time) {
+		t.Errorf("unexpected final event, got: %+v", last)
+	}
+}
+
+func TestTaskName(t *testing.T) {
+	var name string
+	Runner{}.Task("foo", TaskFunc(func(ctx context.Context) error {
+		name, _ = TaskName(ctx)
+		return nil
+	})).Start("foo")
+	if name != "foo" {
+		t.Errorf("unexpected task name, got: %q", name)
+	}
+	if _, ok := TaskName(context.Background()); ok {
+		t.Errorf("task started outside of a run should not have a name")
+	}
+}
+
+func TestShared(t *testing.T) {
+	var values []interface{}
+	task := TaskFunc(func(ctx context.Context) error {
+		values = append(values, Shared(ctx, "key", func() interface{} { return new(int) }))
+		return nil
+	})
+	runner := Runner{}.Task("foo", task).Task("bar", task, "foo")
+	runner.Start("bar")
+	runner.Start("bar")
+	if len(values) != 4 || values[0] != values[1] || values[1] == values[2] || values[2] != values[3] {
+		t.Errorf("values should be shared by the tasks of a run only, got: %v", values)
+	}
+	if Shared(context.Background(), "key", func() interface{} { return new(int) }) == values[0] {
+		t.Errorf("value outside of a run should be new")
+	}
+}
@@ -1,8 +1,8 @@
 package main
 
 import (
-	"fmt"
 	"github.com/ixday/antfarm"
+	"github.com/ixday/antfarm/cli"
 	"github.com/ixday/antfarm/tasks"
 	"io"
 	"os"
@@ -19,11 +19,10 @@ func cmdStdout(w io.Writer) optFn { return func(cmd *exec.Cmd) { cmd.Stdout = w
 
 func main() {
 
-	fmt.Println(antfarm.Runner{}.
+	cli.Main(antfarm.Runner{}.
 		Task("wait", tasks.Wait(5*time.Second)).
 		Task("world", tasks.Print("Hello World!"), "bar", "foo").
 		Task("foo", tasks.Print("Hello Foo!")).
 		Task("bar", tasks.Print("Hello Bar!"), "foo", "wait").
-		Task("exec", tasks.Command("echo", cmdStdout(os.Stdout), cmdArgs("Hello World!"))).
-		Start(os.Args[1:]...))
+		Task("exec", tasks.Command("echo", cmdStdout(os.Stdout), cmdArgs("Hello World!"))))
 }
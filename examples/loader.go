@@ -0,0 +1,18 @@
+package main
+
+import (
+	"fmt"
+	"github.com/ixday/antfarm/cli"
+	"github.com/ixday/antfarm/loader"
+	"os"
+)
+
+// go run loader.go list, the tasks are read from tasks.yaml
+func main() {
+	runner, err := loader.Load("tasks.yaml")
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(cli.ExitUsage)
+	}
+	cli.Main(runner)
+}
@@ -1,30 +1,25 @@
 package main
 
 import (
-	"context"
 	"fmt"
 	"github.com/ixday/antfarm"
 	"github.com/ixday/antfarm/tasks"
 	"time"
 )
 
-type runner struct{ antfarm.Runner }
-
-func NewRunner() runner { return runner{antfarm.Runner{}} }
-func (r runner) Task(name string, task antfarm.Task, deps ...string) runner {
-	r.Runner = r.Runner.Task(name, antfarm.TaskFunc(func(ctx context.Context) error {
-		fmt.Printf("starting task: %s...\n", name)
-		if err := task.Start(ctx); err != nil {
-			return err
-		}
-		fmt.Printf("finished task: %s...\n", name)
-		return nil
-	}), deps...)
-	return r
+func logger(e antfarm.Event) {
+	switch e.Kind {
+	case antfarm.Started:
+		fmt.Printf("starting task: %s...\n", e.Task)
+	case antfarm.Succeeded:
+		fmt.Printf("finished task: %s in %s...\n", e.Task, e.Duration)
+	case antfarm.Failed, antfarm.Cancelled:
+		fmt.Printf("%s task: %s, %s\n", e.Kind, e.Task, e.Err)
+	}
 }
 
 func main() {
-	fmt.Println(NewRunner().
+	fmt.Println(antfarm.Runner{Listeners: []antfarm.Listener{antfarm.ListenerFunc(logger)}}.
 		Task("wait", tasks.Wait(5*time.Second)).
 		Task("world", tasks.Print("Hello World!"), "bar", "foo").
 		Task("foo", tasks.Print("Hello Foo!")).
@@ -0,0 +1,109 @@
+package antfarm
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+type GraphOpts struct {
+	Targets []string // only draw the tasks needed by the targets, every task if empty
+	Report  *Report  // color the tasks according to the result of a run
+}
+
+var colors = map[status]string{succeeded: "#b6e3b6", failed: "#f4a6a6", skipped: "#d9d9d9"}
+
+// graph resolves the tasks to draw along with the status they had during the reported run
+func (runner Runner) graph(options []func(*GraphOpts)) ([]string, map[string]status, error) {
+	opts := GraphOpts{}
+	for _, option := range options {
+		option(&opts)
+	}
+	targets := opts.Targets
+	if len(targets) == 0 {
+		for name := range runner.nodes {
+			targets = append(targets, name)
+		}
+		sort.Strings(targets)
+	}
+
+	resolved, err := runner.Resolve(Node{Deps: targets})
+	if err != nil {
+		return nil, nil, err
+	}
+	statuses := map[string]status{}
+	if report := opts.Report; report != nil {
+		for _, name := range report.Succeeded {
+			statuses[name] = succeeded
+		}
+		for _, err := range report.Failed {
+			statuses[err.Name] = failed
+		}
+		for _, name := range report.Skipped {
+			statuses[name] = skipped
+		}
+	}
+	return resolved[:len(resolved)-1], statuses, nil // root is last
+}
+
+// DOT writes the dependency graph in the Graphviz format, edges go from a dependency to its dependent
+func (runner Runner) DOT(w io.Writer, options ...func(*GraphOpts)) error {
+	resolved, statuses, err := runner.graph(options)
+	if err != nil {
+		return err
+	}
+
+	b := bufio.NewWriter(w)
+	fmt.Fprintln(b, "digraph antfarm {")
+	for _, name := range resolved {
+		if color, ok := colors[statuses[name]]; ok {
+			fmt.Fprintf(b, "\t%s [style=filled, fillcolor=%q];\n", strconv.Quote(name), color)
+		} else {
+			fmt.Fprintf(b, "\t%s;\n", strconv.Quote(name))
+		}
+	}
+	for _, name := range resolved {
+		for _, dep := range runner.nodes[name].Deps {
+			fmt.Fprintf(b, "\t%s -> %s;\n", strconv.Quote(dep), strconv.Quote(name))
+		}
+	}
+	fmt.Fprintln(b, "}")
+	return b.Flush()
+}
+
+// Mermaid writes the dependency graph as a flowchart, edges go from a dependency to its dependent
+func (runner Runner) Mermaid(w io.Writer, options ...func(*GraphOpts)) error {
+	resolved, statuses, err := runner.graph(options)
+	if err != nil {
+		return err
+	}
+
+	ids := map[string]string{}
+	b := bufio.NewWriter(w)
+	fmt.Fprintln(b, "flowchart LR")
+	for i, name := range resolved {
+		ids[name] = fmt.Sprintf("n%d", i)
+		fmt.Fprintf(b, "\t%s[\"%s\"]\n", ids[name], strings.ReplaceAll(name, `"`, "#quot;"))
+	}
+	for _, name := range resolved {
+		for _, dep := range runner.nodes[name].Deps {
+			fmt.Fprintf(b, "\t%s --> %s\n", ids[dep], ids[name])
+		}
+	}
+	for _, s := range []status{succeeded, failed, skipped} {
+		var class []string
+		for _, name := range resolved {
+			if statuses[name] == s {
+				class = append(class, ids[name])
+			}
+		}
+		if class != nil {
+			fmt.Fprintf(b, "\tclassDef %s fill:%s\n", s, colors[s])
+			fmt.Fprintf(b, "\tclass %s %s\n", strings.Join(class, ","), s)
+		}
+	}
+	return b.Flush()
+}
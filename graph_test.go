@@ -0,0 +1,64 @@
+package antfarm
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func graphRunner() Runner {
+	return Runner{}.
+		Task("foo", noop()).
+		Task("bar", noop(), "foo").
+		Task(`b"az`, noop(), "bar", "foo").
+		Task("qux", noop())
+}
+
+func TestDOT(t *testing.T) {
+	var b strings.Builder
+	report := &Report{Succeeded: []string{"foo"}, Failed: TaskErrors{{Name: "bar"}}, Skipped: []string{`b"az`}}
+	err := graphRunner().DOT(&b, func(opts *GraphOpts) {
+		opts.Targets = []string{`b"az`}
+		opts.Report = report
+	})
+	unexpectedErr(t, err, nil)
+
+	expected := "digraph antfarm {\n" +
+		"\t\"foo\" [style=filled, fillcolor=\"#b6e3b6\"];\n" +
+		"\t\"bar\" [style=filled, fillcolor=\"#f4a6a6\"];\n" +
+		"\t\"b\\\"az\" [style=filled, fillcolor=\"#d9d9d9\"];\n" +
+		"\t\"foo\" -> \"bar\";\n" +
+		"\t\"bar\" -> \"b\\\"az\";\n" +
+		"\t\"foo\" -> \"b\\\"az\";\n" +
+		"}\n"
+	if b.String() != expected {
+		t.Errorf("unexpected graph, got:\n%s\nexpected:\n%s", b.String(), expected)
+	}
+}
+
+func TestMermaid(t *testing.T) {
+	var b strings.Builder
+	report := &Report{Succeeded: []string{"foo", "qux"}}
+	unexpectedErr(t, graphRunner().Mermaid(&b, func(opts *GraphOpts) { opts.Report = report }), nil)
+
+	expected := "flowchart LR\n" +
+		"\tn0[\"foo\"]\n" +
+		"\tn1[\"bar\"]\n" +
+		"\tn2[\"b#quot;az\"]\n" +
+		"\tn3[\"qux\"]\n" +
+		"\tn0 --> n1\n" +
+		"\tn1 --> n2\n" +
+		"\tn0 --> n2\n" +
+		"\tclassDef succeeded fill:#b6e3b6\n" +
+		"\tclass n0,n3 succeeded\n"
+	if b.String() != expected {
+		t.Errorf("unexpected graph, got:\n%s\nexpected:\n%s", b.String(), expected)
+	}
+}
+
+func TestGraphDependencyErr(t *testing.T) {
+	err := Runner{}.Task("foo", noop(), "bar").DOT(&strings.Builder{})
+	if !errors.Is(err, ErrDepNotFound) {
+		t.Errorf("unexpected error type, got: %s, expected: %s", err, ErrDepNotFound)
+	}
+}
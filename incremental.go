@@ -0,0 +1,313 @@
+package antfarm
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+)
+
+const (
+	DefaultState = ".antfarm/state.json"
+	stateName    = "antfarm:state" // reports the failures to save the state
+)
+
+type (
+	// fingerprint holds what a tracked task saw on its last success
+	fingerprint struct {
+		Inputs  map[string]string `json:"inputs,omitempty"`
+		Outputs map[string]string `json:"outputs,omitempty"`
+		Deps    map[string]string `json:"deps,omitempty"`
+		Digest  string            `json:"digest"` // outputs of the task and of everything upstream
+	}
+
+	// fingerprints is the state shared by the tasks of a run
+	fingerprints struct {
+		sync.Mutex
+		path    string
+		entries map[string]*fingerprint
+		digests map[string]string // computed during the run, for every task
+		touched map[string]bool   // entries set or dropped by the run, the others are left to concurrent runs
+	}
+)
+
+// runs of the same runner may save the state at once, see save
+var stateMu sync.Mutex
+
+func (node Node) tracked() bool { return len(node.Inputs) > 0 || len(node.Outputs) > 0 }
+
+// glob extends filepath.Glob with ** matching any number of directories
+func glob(pattern string) ([]string, error) {
+	i := strings.Index(pattern, "**")
+	if i < 0 {
+		return filepath.Glob(pattern)
+	}
+	root, rest := filepath.Clean(pattern[:i]+"."), strings.TrimPrefix(pattern[i+2:], "/")
+	if _, err := filepath.Match(rest, ""); err != nil {
+		return nil, err
+	}
+
+	var matches []string
+	err := filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		}
+		if info.IsDir() {
+			return nil
+		}
+		rel, _ := filepath.Rel(root, path)
+		parts := strings.Split(filepath.ToSlash(rel), "/")
+		for j := range parts {
+			if ok, _ := filepath.Match(rest, strings.Join(parts[j:], "/")); ok || rest == "" {
+				matches = append(matches, path)
+				break
+			}
+		}
+		return nil
+	})
+	return matches, err
+}
+
+func hashFile(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// hashFiles hashes the files matched by the patterns, directories are hashed file by file.
+// Missing paths are left out, globs only match what exists anyway.
+func hashFiles(patterns []string) (map[string]string, error) {
+	hashes := map[string]string{}
+	for _, pattern := range patterns {
+		matches, err := glob(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", pattern, err)
+		}
+		for _, match := range matches {
+			err := filepath.Walk(match, func(path string, info os.FileInfo, err error) error {
+				if err != nil || info.IsDir() {
+					return err
+				}
+				hashes[path], err = hashFile(path)
+				return err
+			})
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+	return hashes, nil
+}
+
+// digest sums up the hashes, keys included
+func digest(hashes ...map[string]string) string {
+	h := sha256.New()
+	for _, m := range hashes {
+		keys := make([]string, 0, len(m))
+		for key := range m {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			fmt.Fprintf(h, "%s\x00%s\x00", key, m[key])
+		}
+		h.Write([]byte{0})
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+func equal(m1, m2 map[string]string) bool {
+	if len(m1) != len(m2) {
+		return false
+	}
+	for key, v := range m1 {
+		if w, ok := m2[key]; !ok || v != w {
+			return false
+		}
+	}
+	return true
+}
+
+// state reads the fingerprints of the previous runs, an unreadable state only costs a rebuild
+func (runner Runner) state() *fingerprints {
+	path := runner.State
+	if path == "" {
+		path = DefaultState
+	}
+	return &fingerprints{path: path, entries: load(path), digests: map[string]string{}, touched: map[string]bool{}}
+}
+
+func load(path string) map[string]*fingerprint {
+	entries := map[string]*fingerprint{}
+	if b, err := ioutil.ReadFile(path); err == nil {
+		if err := json.Unmarshal(b, &entries); err != nil {
+			return map[string]*fingerprint{}
+		}
+	}
+	return entries
+}
+
+// save merges the entries touched by the run into the state as it is now, concurrent runs keep theirs.
+// The state is written next to its final location first, not to leave a truncated file behind.
+func (f *fingerprints) save() error {
+	f.Lock()
+	defer f.Unlock()
+	stateMu.Lock()
+	defer stateMu.Unlock()
+	entries := load(f.path)
+	for name := range f.touched {
+		if entry, ok := f.entries[name]; ok {
+			entries[name] = entry
+		} else {
+			delete(entries, name)
+		}
+	}
+	b, err := json.MarshalIndent(entries, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(f.path), 0755); err != nil {
+		return err
+	}
+	tmp, err := ioutil.TempFile(filepath.Dir(f.path), "."+filepath.Base(f.path)+".")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name()) // no-op once renamed
+	_, err = tmp.Write(b)
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Chmod(tmp.Name(), 0644)
+	}
+	if err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), f.path)
+}
+
+// current computes the inputs of the node, its outputs as they are now and the digests of its dependencies
+func (f *fingerprints) current(node Node) (*fingerprint, error) {
+	inputs, err := hashFiles(node.Inputs)
+	if err != nil {
+		return nil, err
+	}
+	outputs, err := hashFiles(node.Outputs)
+	if err != nil {
+		return nil, err
+	}
+	deps := map[string]string{}
+	f.Lock()
+	defer f.Unlock()
+	for _, dep := range node.Deps {
+		deps[dep] = f.digests[dep]
+	}
+	return &fingerprint{Inputs: inputs, Outputs: outputs, Deps: deps}, nil
+}
+
+// upToDate tells if nothing changed since the last success, every output must exist
+func (f *fingerprints) upToDate(node Node, current *fingerprint) bool {
+	f.Lock()
+	defer f.Unlock()
+	last, ok := f.entries[node.Name]
+	if !ok {
+		return false
+	}
+	for _, output := range node.Outputs {
+		if matches, _ := glob(output); len(matches) == 0 {
+			return false
+		}
+	}
+	return equal(last.Inputs, current.Inputs) && equal(last.Outputs, current.Outputs) && equal(last.Deps, current.Deps)
+}
+
+// track wraps the task of a node to skip it when it is up to date, and records what it produced otherwise.
+// Untracked nodes always run, they still forward the digests of their dependencies to their dependents.
+func (f *fingerprints) track(node Node, task Task) Task {
+	return TaskFunc(func(ctx context.Context) error {
+		current, err := f.current(node)
+		if err != nil {
+			return err
+		}
+		if node.tracked() && f.upToDate(node, current) {
+			f.Lock()
+			f.digests[node.Name] = f.entries[node.Name].Digest
+			f.Unlock()
+			emit(ctx, Satisfied)
+			return nil
+		}
+
+		f.Lock()
+		delete(f.entries, node.Name) // until it succeeds
+		f.touched[node.Name] = true
+		f.Unlock()
+		if err := task.Start(ctx); err != nil || ctx.Err() != nil { // interrupted, the work may not be done
+			return err
+		}
+		if current.Outputs, err = hashFiles(node.Outputs); err != nil {
+			return err
+		}
+		current.Digest = digest(current.Outputs, current.Deps)
+
+		f.Lock()
+		defer f.Unlock()
+		f.digests[node.Name] = current.Digest
+		if node.tracked() {
+			f.entries[node.Name] = current
+		}
+		return nil
+	})
+}
+
+// forget drops the fingerprint of a node, it runs again next time
+func (f *fingerprints) forget(name string) {
+	f.Lock()
+	defer f.Unlock()
+	delete(f.entries, name)
+	f.touched[name] = true
+}
+
+// stale tells, without running anything, if the node would run because of its files or of an upstream change.
+// Dependencies are assumed to be planned already, the unchanged ones are expected to keep their outputs.
+func (f *fingerprints) stale(node Node, changed map[string]bool) (bool, string, error) {
+	for _, dep := range node.Deps {
+		if changed[dep] {
+			return true, "upstream outputs changed", nil
+		}
+	}
+	current, err := f.current(node)
+	if err != nil {
+		return true, "", err
+	}
+	if !node.tracked() {
+		f.digests[node.Name] = digest(current.Outputs, current.Deps)
+		return false, "", nil
+	}
+	if !f.upToDate(node, current) {
+		if _, ok := f.entries[node.Name]; !ok {
+			return true, "never succeeded", nil
+		}
+		return true, "inputs or outputs changed", nil
+	}
+	f.digests[node.Name] = f.entries[node.Name].Digest
+	return false, "up to date", nil
+}
@@ -0,0 +1,233 @@
+package antfarm
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+)
+
+func helperDir(t *testing.T) string {
+	t.Helper()
+	dir, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	return dir
+}
+
+func helperWrite(t *testing.T, path, content string) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// incremental builds a graph where build writes the length of its source and pack copies it
+func incremental(t *testing.T, dir string) (Runner, map[string]int) {
+	counts := map[string]int{}
+	src, out, pack := filepath.Join(dir, "src.txt"), filepath.Join(dir, "out.txt"), filepath.Join(dir, "pack.txt")
+	build := TaskFunc(func(_ context.Context) error {
+		counts["build"]++
+		b, err := ioutil.ReadFile(src)
+		if err != nil {
+			return err
+		}
+		return ioutil.WriteFile(out, []byte(fmt.Sprint(len(b))), 0644)
+	})
+	packer := TaskFunc(func(_ context.Context) error {
+		counts["pack"]++
+		b, err := ioutil.ReadFile(out)
+		if err != nil {
+			return err
+		}
+		return ioutil.WriteFile(pack, b, 0644)
+	})
+	runner := Runner{State: filepath.Join(dir, "state", "state.json")}.
+		Add(Node{Name: "build", Task: build, Inputs: []string{src}, Outputs: []string{out}}).
+		Add(Node{Name: "pack", Task: packer, Deps: []string{"build"}, Outputs: []string{pack}})
+	return runner, counts
+}
+
+func TestIncremental(t *testing.T) {
+	dir := helperDir(t)
+	helperWrite(t, filepath.Join(dir, "src.txt"), "foo")
+	runner, counts := incremental(t, dir)
+	expect := func(build, pack int) {
+		t.Helper()
+		if err := runner.Start("pack"); err != nil {
+			t.Fatal(err)
+		}
+		if counts["build"] != build || counts["pack"] != pack {
+			t.Errorf("unexpected runs, got: %v, expected: build %d pack %d", counts, build, pack)
+		}
+	}
+
+	expect(1, 1)
+	expect(1, 1) // nothing changed
+	helperWrite(t, filepath.Join(dir, "src.txt"), "bar")
+	expect(2, 1) // same output, pack is up to date
+	helperWrite(t, filepath.Join(dir, "src.txt"), "quux")
+	expect(3, 2) // upstream output changed
+	os.Remove(filepath.Join(dir, "pack.txt"))
+	expect(3, 3) // missing output
+	helperWrite(t, filepath.Join(dir, "out.txt"), "tampered")
+	expect(4, 3) // output changed outside of the runner, rebuilt the same
+}
+
+func TestIncrementalFailure(t *testing.T) {
+	dir := helperDir(t)
+	helperWrite(t, filepath.Join(dir, "src.txt"), "foo")
+	runner, counts := incremental(t, dir)
+	if err := runner.Start("pack"); err != nil {
+		t.Fatal(err)
+	}
+
+	fail := true
+	node, _ := runner.Lookup("build")
+	task := node.Task
+	node.Task = TaskFunc(func(ctx context.Context) error {
+		if fail {
+			return errors.New("foo")
+		}
+		return task.Start(ctx)
+	})
+	runner = runner.Add(node)
+	helperWrite(t, filepath.Join(dir, "src.txt"), "quux")
+	if err := runner.Start("pack"); err == nil {
+		t.Fatal("expected an error")
+	}
+	helperWrite(t, filepath.Join(dir, "src.txt"), "foo") // back to the last success, still needs a run
+	fail = false
+	if err := runner.Start("pack"); err != nil {
+		t.Fatal(err)
+	}
+	if counts["build"] != 2 || counts["pack"] != 1 {
+		t.Errorf("unexpected runs, got: %v", counts)
+	}
+}
+
+func TestIncrementalCancel(t *testing.T) {
+	dir := helperDir(t)
+	helperWrite(t, filepath.Join(dir, "src.txt"), "foo")
+	var runs int
+	started := make(chan bool, 1)
+	runner := Runner{State: filepath.Join(dir, "state.json")}.Add(Node{
+		Name:   "wait",
+		Inputs: []string{filepath.Join(dir, "src.txt")},
+		Task: TaskFunc(func(ctx context.Context) error {
+			if runs++; runs == 1 {
+				started <- true
+				<-ctx.Done()
+			}
+			return nil // as tasks.Wait does when interrupted
+		}),
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		<-started
+		cancel()
+	}()
+	runner.ExecuteContext(ctx, "wait")
+	unexpectedErr(t, runner.Start("wait"), nil)
+	if runs != 2 {
+		t.Errorf("an interrupted task should not be up to date, got: %d runs", runs)
+	}
+}
+
+func TestIncrementalConcurrent(t *testing.T) {
+	dir := helperDir(t)
+	state := filepath.Join(dir, "state.json")
+	runner := Runner{State: state}
+	for _, name := range []string{"foo", "bar"} {
+		helperWrite(t, filepath.Join(dir, name), name)
+		runner = runner.Add(Node{Name: name, Task: noop(), Inputs: []string{filepath.Join(dir, name)}})
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		for _, target := range []string{"foo", "bar"} {
+			wg.Add(1)
+			go func(target string) {
+				defer wg.Done()
+				if err := runner.Start(target); err != nil {
+					t.Error(err)
+				}
+			}(target)
+		}
+	}
+	wg.Wait()
+	if entries := load(state); entries["foo"] == nil || entries["bar"] == nil {
+		t.Errorf("the runs should keep the entries of each other, got: %v", entries)
+	}
+}
+
+func TestIncrementalPlan(t *testing.T) {
+	dir := helperDir(t)
+	helperWrite(t, filepath.Join(dir, "src.txt"), "foo")
+	runner, _ := incremental(t, dir)
+	runner = runner.Task("deploy", noop(), "pack")
+
+	plan, err := runner.Plan("deploy")
+	unexpectedErr(t, err, nil)
+	expected := "wave 1:\n" +
+		"  run build: never succeeded\n" +
+		"wave 2:\n" +
+		"  run pack: upstream outputs changed\n" +
+		"wave 3:\n" +
+		"  run deploy: upstream outputs changed\n"
+	if plan.String() != expected {
+		t.Errorf("unexpected plan, got:\n%s\nexpected:\n%s", plan, expected)
+	}
+
+	unexpectedErr(t, runner.Start("deploy"), nil)
+	plan, err = runner.Plan("deploy")
+	unexpectedErr(t, err, nil)
+	expected = "wave 1:\n" +
+		"  skip build: up to date\n" +
+		"wave 2:\n" +
+		"  skip pack: up to date\n" +
+		"wave 3:\n" +
+		"  run deploy: no expectation\n"
+	if plan.String() != expected {
+		t.Errorf("unexpected plan, got:\n%s\nexpected:\n%s", plan, expected)
+	}
+
+	helperWrite(t, filepath.Join(dir, "src.txt"), "quux")
+	plan, err = runner.Plan("deploy")
+	unexpectedErr(t, err, nil)
+	if plan.Steps[0].Reason != "inputs or outputs changed" || plan.Steps[1].Reason != "upstream outputs changed" {
+		t.Errorf("unexpected plan, got:\n%s", plan)
+	}
+}
+
+func TestGlob(t *testing.T) {
+	dir := helperDir(t)
+	for _, name := range []string{"a.go", "b.txt", "sub/c.go", "sub/deep/d.go", "sub/deep/e.txt"} {
+		helperWrite(t, filepath.Join(dir, name), name)
+	}
+	for pattern, expected := range map[string][]string{
+		"*.go":         {"a.go"},
+		"**/*.go":      {"a.go", "sub/c.go", "sub/deep/d.go"},
+		"sub/**":       {"sub/c.go", "sub/deep/d.go", "sub/deep/e.txt"},
+		"sub/**/d.go":  {"sub/deep/d.go"},
+		"missing/**":   nil,
+		"**/deep/*.go": {"sub/deep/d.go"},
+	} {
+		matches, err := glob(filepath.Join(dir, pattern))
+		unexpectedErr(t, err, nil)
+		for i := range expected {
+			expected[i] = filepath.Join(dir, expected[i])
+		}
+		compare(t, matches, expected)
+	}
+}
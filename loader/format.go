@@ -0,0 +1,193 @@
+package loader
+
+import (
+	"errors"
+	"fmt"
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v3"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+var yamlLine = regexp.MustCompile(`^yaml: line (\d+): `)
+
+// value is an element of a decoded file along with the line it was found at
+type value struct {
+	line int
+	data interface{} // scalar, []*value or map[string]*value
+	keys []string    // order of the keys of a map, as written in the file
+}
+
+func (v *value) kind() string {
+	switch v.data.(type) {
+	case nil:
+		return "null"
+	case string:
+		return "string"
+	case bool:
+		return "boolean"
+	case int64:
+		return "integer"
+	case float64:
+		return "float"
+	case []*value:
+		return "list"
+	case map[string]*value:
+		return "map"
+	}
+	return fmt.Sprintf("%T", v.data)
+}
+
+func decodeYAML(file string, src []byte) (*value, error) {
+	var doc yaml.Node
+	if err := yaml.Unmarshal(src, &doc); err != nil {
+		msg := err.Error()
+		if m := yamlLine.FindStringSubmatch(msg); m != nil {
+			line, _ := strconv.Atoi(m[1])
+			return nil, &Error{file, line, errors.New(msg[len(m[0]):])}
+		}
+		return nil, &Error{File: file, Err: errors.New(strings.TrimPrefix(msg, "yaml: "))}
+	}
+	if len(doc.Content) == 0 { // empty file
+		return &value{line: 1, data: map[string]*value{}}, nil
+	}
+	return fromYAML(file, doc.Content[0])
+}
+
+func fromYAML(file string, n *yaml.Node) (*value, error) {
+	switch n.Kind {
+	case yaml.AliasNode:
+		return fromYAML(file, n.Alias)
+	case yaml.MappingNode:
+		m := map[string]*value{}
+		v := &value{line: n.Line, data: m}
+		for i := 0; i+1 < len(n.Content); i += 2 {
+			key, child := n.Content[i], n.Content[i+1]
+			if first, ok := m[key.Value]; ok {
+				return nil, &Error{file, key.Line, fmt.Errorf("key %q already defined at line %d", key.Value, first.line)}
+			}
+			c, err := fromYAML(file, child)
+			if err != nil {
+				return nil, err
+			}
+			c.line = key.Line // point at the key, the value may be on the following lines
+			m[key.Value] = c
+			v.keys = append(v.keys, key.Value)
+		}
+		return v, nil
+	case yaml.SequenceNode:
+		var l []*value
+		for _, child := range n.Content {
+			c, err := fromYAML(file, child)
+			if err != nil {
+				return nil, err
+			}
+			l = append(l, c)
+		}
+		return &value{line: n.Line, data: l}, nil
+	}
+
+	var data interface{}
+	if err := n.Decode(&data); err != nil {
+		return nil, &Error{file, n.Line, err}
+	}
+	switch d := data.(type) {
+	case int:
+		data = int64(d)
+	case uint64:
+		data = float64(d)
+	}
+	return &value{line: n.Line, data: data}, nil
+}
+
+func decodeTOML(file string, src []byte) (*value, error) {
+	var doc map[string]interface{}
+	if _, err := toml.Decode(string(src), &doc); err != nil {
+		var perr toml.ParseError
+		if errors.As(err, &perr) {
+			return nil, &Error{file, perr.Position.Line, errors.New(perr.Message)}
+		}
+		return nil, &Error{File: file, Err: err}
+	}
+	return fromTOML(tomlLines(string(src)), nil, 1, doc), nil
+}
+
+func fromTOML(lines map[string]int, path []string, line int, data interface{}) *value {
+	if l, ok := lines[strings.Join(path, ".")]; ok {
+		line = l
+	}
+	switch d := data.(type) {
+	case map[string]interface{}:
+		m := map[string]*value{}
+		v := &value{line: line, data: m}
+		for key := range d {
+			v.keys = append(v.keys, key)
+		}
+		child := func(key string) []string { return append(path[:len(path):len(path)], key) }
+		sort.Slice(v.keys, func(i, j int) bool { // as written in the file when the lines are known
+			li, lj := lines[strings.Join(child(v.keys[i]), ".")], lines[strings.Join(child(v.keys[j]), ".")]
+			if li != lj {
+				return li < lj
+			}
+			return v.keys[i] < v.keys[j]
+		})
+		for _, key := range v.keys {
+			m[key] = fromTOML(lines, child(key), line, d[key])
+		}
+		return v
+	case []map[string]interface{}:
+		var l []*value
+		for _, child := range d {
+			l = append(l, fromTOML(lines, nil, line, child))
+		}
+		return &value{line: line, data: l}
+	case []interface{}:
+		var l []*value
+		for _, child := range d {
+			l = append(l, fromTOML(lines, nil, line, child))
+		}
+		return &value{line: line, data: l}
+	}
+	return &value{line: line, data: data}
+}
+
+// tomlLines finds the line of the tables and the keys, the decoder does not expose them
+func tomlLines(src string) map[string]int {
+	lines := map[string]int{}
+	var table []string
+	record := func(path []string, line int) {
+		if key := strings.Join(path, "."); key != "" {
+			if _, ok := lines[key]; !ok {
+				lines[key] = line
+			}
+		}
+	}
+	for i, line := range strings.Split(src, "\n") {
+		line = strings.TrimSpace(line)
+		switch {
+		case line == "" || line[0] == '#':
+		case line[0] == '[':
+			table = tomlKey(strings.Trim(strings.SplitN(line, "]", 2)[0], "[ "))
+			for j := range table { // parent tables are implicitly defined by their first child
+				record(table[:j+1], i+1)
+			}
+		default:
+			if eq := strings.IndexByte(line, '='); eq > 0 {
+				path := append(table[:len(table):len(table)], tomlKey(line[:eq])...)
+				for j := len(table); j < len(path); j++ {
+					record(path[:j+1], i+1)
+				}
+			}
+		}
+	}
+	return lines
+}
+
+func tomlKey(s string) (key []string) {
+	for _, part := range strings.Split(s, ".") {
+		key = append(key, strings.Trim(strings.TrimSpace(part), `"'`))
+	}
+	return key
+}
@@ -0,0 +1,261 @@
+// Package loader builds a runner out of a YAML or TOML file:
+//
+//	include: [common.yaml]          # relative to the including file
+//	vars: {out: build}              # used as ${out} in the strings
+//	resources: {db: 1}              # see Runner.Resources
+//	tasks:
+//	  build:
+//	    type: command               # constructor found in the registry
+//	    command: go
+//	    args: [build, -o, "${out}/app"]
+//	    prefix: true                # [build] before each line, color: true to colour it
+//	    quiet: true                 # output shown only on failure
+//	    deps: [generate]
+//	    description: build the binary
+//	    tags: [ci]
+//	    hidden: false
+//	    weight: 1
+//	    resources: [db]
+//	    timeout: 5m
+//	    inputs: ["**/*.go"]         # see Node.Inputs
+//	    outputs: ["${out}/app"]
+//	    retry: {attempts: 3, delay: 1s, max_delay: 10s, jitter: 0.1}
+//	    annotations: {owner: ops}
+//	  assets:
+//	    type: sync                  # also command, copy, print and wait
+//	    src: static
+//	    dest: "${out}/static"
+//	    exclude: ["*.tmp"]
+//	    delete: true
+//	    preserve: true              # modes, times and symlinks
+//	    checksum: xxhash            # see tasks.Hashes
+//
+// The remaining keys of a task are handed to its constructor.
+package loader
+
+import (
+	"fmt"
+	"github.com/ixday/antfarm"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+)
+
+type (
+	Opts struct {
+		Registry Registry          // constructors of the task types, Builtins if not set
+		Vars     map[string]string // take precedence over the variables of the files
+	}
+
+	// Error locates a problem in a file, line is 0 when unknown
+	Error struct {
+		File string
+		Line int
+		Err  error
+	}
+
+	// Errors gathers every problem found while loading, in the order of the files
+	Errors []*Error
+
+	loader struct {
+		Opts
+		runner  antfarm.Runner
+		vars    map[string]string
+		tasks   []task
+		defined map[string]*Error // where each task comes from
+		loading []string          // chain of includes, to detect loops
+		errs    Errors
+	}
+
+	task struct {
+		name, file string
+		value      *value
+	}
+)
+
+func (e *Error) Error() string {
+	if e.Line == 0 {
+		return fmt.Sprintf("%s: %s", e.File, e.Err)
+	}
+	return fmt.Sprintf("%s:%d: %s", e.File, e.Line, e.Err)
+}
+
+func (e *Error) Unwrap() error { return e.Err }
+
+func (errs Errors) Error() string {
+	msgs := make([]string, len(errs))
+	for i, err := range errs {
+		msgs[i] = err.Error()
+	}
+	return strings.Join(msgs, "\n")
+}
+
+func (errs Errors) Unwrap() []error {
+	out := make([]error, len(errs))
+	for i, err := range errs {
+		out[i] = err
+	}
+	return out
+}
+
+// Load reads the tasks of a file and its includes, the format depends on its extension
+func Load(path string, options ...func(*Opts)) (antfarm.Runner, error) {
+	l := loader{vars: map[string]string{}, defined: map[string]*Error{}}
+	for _, option := range options {
+		option(&l.Opts)
+	}
+	if l.Registry == nil {
+		l.Registry = Builtins()
+	}
+	for name, v := range l.Vars {
+		l.vars[name] = v
+	}
+
+	if err := l.load(path); err != nil {
+		return antfarm.Runner{}, Errors{err}
+	}
+	for _, t := range l.tasks {
+		l.build(t)
+	}
+	if l.errs != nil {
+		return antfarm.Runner{}, l.errs
+	}
+	return l.runner, nil
+}
+
+func (l *loader) load(path string) *Error {
+	src, err := ioutil.ReadFile(path)
+	if err != nil {
+		return &Error{File: path, Err: err}
+	}
+	var doc *value
+	switch ext := filepath.Ext(path); ext {
+	case ".yaml", ".yml":
+		doc, err = decodeYAML(path, src)
+	case ".toml":
+		doc, err = decodeTOML(path, src)
+	default:
+		return &Error{File: path, Err: fmt.Errorf("unsupported format %q, expected .yaml, .yml or .toml", ext)}
+	}
+	if err != nil {
+		return err.(*Error)
+	}
+	if doc.kind() != "map" {
+		return &Error{path, doc.line, fmt.Errorf("expected a map, got a %s", doc.kind())}
+	}
+
+	abs, _ := filepath.Abs(path)
+	l.loading = append(l.loading, abs)
+	defer func() { l.loading = l.loading[:len(l.loading)-1] }()
+
+	p := newParams(path, doc, l.vars, &l.errs)
+	for _, include := range p.Strings("include") {
+		if !filepath.IsAbs(include) {
+			include = filepath.Join(filepath.Dir(path), include)
+		}
+		if abs, _ := filepath.Abs(include); in(abs, l.loading) {
+			p.Errorf("include", "include loop: %s -> %s", strings.Join(l.loading, " -> "), abs)
+		} else if err := l.load(include); err != nil && err.Line == 0 { // unreadable, blame the include
+			p.Errorf("include", "%w", err.Err)
+		} else if err != nil {
+			l.errs = append(l.errs, err)
+		}
+	}
+
+	vars := p.Sub("vars") // after the includes, to override their values
+	for _, name := range vars.keys {
+		v := vars.values[name]
+		switch v.data.(type) {
+		case bool, int64, float64:
+			vars.used[name] = true
+			l.set(name, fmt.Sprint(v.data))
+		default:
+			l.set(name, vars.String(name))
+		}
+	}
+	resources := p.Sub("resources")
+	for _, name := range resources.keys {
+		if l.runner.Resources == nil {
+			l.runner.Resources = map[string]int{}
+		}
+		l.runner.Resources[name] = resources.Int(name)
+	}
+	if v, ok := p.get("tasks", "map"); ok {
+		for _, name := range v.keys {
+			t := v.data.(map[string]*value)[name]
+			if from, ok := l.defined[name]; ok {
+				l.errs = append(l.errs, &Error{path, t.line, fmt.Errorf("task %q already defined at %s:%d", name, from.File, from.Line)})
+				continue
+			}
+			l.defined[name] = &Error{File: path, Line: t.line}
+			l.tasks = append(l.tasks, task{name, path, t})
+		}
+	}
+	p.unused()
+	return nil
+}
+
+func (l *loader) set(name, v string) {
+	if _, ok := l.Vars[name]; !ok {
+		l.vars[name] = v
+	}
+}
+
+func (l *loader) build(t task) {
+	if t.value.kind() != "map" {
+		l.errs = append(l.errs, &Error{t.file, t.value.line, fmt.Errorf("task %q must be a map, got a %s", t.name, t.value.kind())})
+		return
+	}
+	p := newParams(t.file, t.value, l.vars, &l.errs)
+	node := antfarm.Node{
+		Name:        t.name,
+		Deps:        p.Strings("deps"),
+		Weight:      p.Int("weight"),
+		Resources:   p.Strings("resources"),
+		Timeout:     p.Duration("timeout"),
+		Inputs:      p.Strings("inputs"),
+		Outputs:     p.Strings("outputs"),
+		Description: p.String("description"),
+		Tags:        p.Strings("tags"),
+		Hidden:      p.Bool("hidden"),
+	}
+	node.Annotations, _ = p.Map("annotations")
+	if p.Has("retry") {
+		retry := p.Sub("retry")
+		node.Retry = antfarm.RetryPolicy{
+			Attempts: retry.Int("attempts"),
+			Delay:    retry.Duration("delay"),
+			MaxDelay: retry.Duration("max_delay"),
+			Jitter:   retry.Float("jitter"),
+		}
+	}
+	for _, dep := range node.Deps {
+		if _, ok := l.defined[dep]; !ok {
+			p.Errorf("deps", "task %q depends on unknown task %q", t.name, dep)
+		}
+	}
+
+	kind := p.String("type")
+	constructor, ok := l.Registry[kind]
+	switch {
+	case !p.Require("type"):
+		return
+	case !ok:
+		p.Errorf("type", "unknown task type %q", kind)
+		return // the remaining keys belong to the unknown type
+	}
+	if node.Task = constructor(p); node.Task == nil { // the constructor reported why
+		return
+	}
+	p.unused()
+	l.runner = l.runner.Add(node)
+}
+
+func in(value string, array []string) bool {
+	for _, elt := range array {
+		if value == elt {
+			return true
+		}
+	}
+	return false
+}
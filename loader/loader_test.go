@@ -0,0 +1,252 @@
+package loader
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"github.com/ixday/antfarm"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// write the files in a temporary directory and return the path of the first one
+func helperFiles(t *testing.T, files ...string) string {
+	t.Helper()
+	dir, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	for i := 0; i+1 < len(files); i += 2 {
+		if err := ioutil.WriteFile(filepath.Join(dir, files[i]), []byte(files[i+1]), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return filepath.Join(dir, files[0])
+}
+
+func helperErrors(t *testing.T, err error, expected ...string) {
+	t.Helper()
+	var errs Errors
+	if !errors.As(err, &errs) {
+		t.Fatalf("unexpected error, got: %v, expected: %s", err, expected)
+	}
+	if len(errs) != len(expected) {
+		t.Fatalf("unexpected errors, got: %s, expected: %s", err, expected)
+	}
+	for i, e := range errs {
+		if got := filepath.Base(e.File) + ":" + strings.SplitN(e.Error(), ":", 2)[1]; got != expected[i] {
+			t.Errorf("unexpected error, got: %s, expected: %s", got, expected[i])
+		}
+	}
+}
+
+// record lets the tests see what the constructors received
+func record(out *bytes.Buffer) func(*Opts) {
+	return func(opts *Opts) {
+		opts.Registry = Builtins()
+		opts.Registry["record"] = func(p *Params) antfarm.Task {
+			msg := p.String("message")
+			return antfarm.TaskFunc(func(_ context.Context) error {
+				out.WriteString(msg + "\n")
+				return nil
+			})
+		}
+	}
+}
+
+func TestLoadYAML(t *testing.T) {
+	out := &bytes.Buffer{}
+	path := helperFiles(t, "main.yaml", `
+vars:
+  name: world
+resources:
+  db: 2
+tasks:
+  hello:
+    type: record
+    message: hello ${name}
+    deps: [first]
+    description: say hello
+    tags: [greet]
+    timeout: 1m
+    retry: {attempts: 3, delay: 1s}
+    resources: db
+    annotations: {owner: ops}
+    inputs: ["*.go"]
+    outputs: ${name}.txt
+  first:
+    type: record
+    message: first
+    hidden: true
+    weight: 2
+`)
+	runner, err := Load(path, record(out))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := runner.Start("hello"); err != nil {
+		t.Fatal(err)
+	}
+	if out.String() != "first\nhello world\n" {
+		t.Errorf("unexpected output: %q", out)
+	}
+
+	node, _ := runner.Lookup("hello")
+	if node.Description != "say hello" || !node.HasTag("greet") || node.Timeout != time.Minute ||
+		node.Retry.Attempts != 3 || node.Retry.Delay != time.Second ||
+		len(node.Resources) != 1 || node.Annotations["owner"] != "ops" ||
+		len(node.Inputs) != 1 || node.Outputs[0] != "world.txt" {
+		t.Errorf("unexpected node: %+v", node)
+	}
+	if node, _ := runner.Lookup("first"); !node.Hidden || node.Weight != 2 {
+		t.Errorf("unexpected node: %+v", node)
+	}
+	if runner.Resources["db"] != 2 {
+		t.Errorf("unexpected resources: %v", runner.Resources)
+	}
+}
+
+func TestLoadTOML(t *testing.T) {
+	out := &bytes.Buffer{}
+	path := helperFiles(t, "main.toml", `
+[vars]
+name = "world"
+count = 2
+
+[tasks.hello]
+type = "record"
+message = "hello ${name} ${count}"
+deps = ["first"]
+
+[tasks.first]
+type = "record"
+message = "first"
+`)
+	runner, err := Load(path, record(out))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := runner.Start("hello"); err != nil {
+		t.Fatal(err)
+	}
+	if out.String() != "first\nhello world 2\n" {
+		t.Errorf("unexpected output: %q", out)
+	}
+}
+
+func TestLoadInclude(t *testing.T) {
+	out := &bytes.Buffer{}
+	path := helperFiles(t,
+		"main.yaml", `
+include: [common.toml]
+vars: {name: main}
+tasks:
+  hello: {type: record, message: "hello ${name} ${from}", deps: [common]}
+`,
+		"common.toml", `
+include = ["base.yaml"]
+[vars]
+name = "common"
+from = "common"
+[tasks.common]
+type = "record"
+message = "${name}"
+`,
+		"base.yaml", "vars: {name: base}\n")
+
+	runner, err := Load(path, record(out))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := runner.Start("hello"); err != nil {
+		t.Fatal(err)
+	}
+	if out.String() != "main\nhello main common\n" { // variables are resolved once every file is read
+		t.Errorf("unexpected output: %q", out)
+	}
+
+	out.Reset()
+	runner, err = Load(path, record(out), func(opts *Opts) { opts.Vars = map[string]string{"name": "cli"} })
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := runner.Start("hello"); err != nil {
+		t.Fatal(err)
+	}
+	if out.String() != "cli\nhello cli common\n" {
+		t.Errorf("unexpected output: %q", out)
+	}
+}
+
+func TestLoadErrors(t *testing.T) {
+	path := helperFiles(t, "main.yaml", `
+include: [other.yaml]
+tasks:
+  a:
+    type: print
+    mesage: typo
+  b:
+    type: nope
+  c:
+    type: wait
+    duration: forever
+    deps: [a, z]
+  d:
+    type: command
+    command: [ls]
+    args: ${undefined}
+  e: {type: copy, src: a, dest: b, checksum: crc32}
+  f: {type: sync, src: a, dest: b, delete: yes please}
+  g: {type: command, command: "true", quiet: sometimes}
+`,
+		"other.yaml", "tasks:\n  o: {type: print, message: [1]}\n")
+
+	_, err := Load(path)
+	helperErrors(t, err,
+		"other.yaml:2: \"message\" must be a string, got a list",
+		"main.yaml:4: missing key \"message\"",
+		"main.yaml:8: unknown task type \"nope\"",
+		"main.yaml:12: task \"c\" depends on unknown task \"z\"",
+		"main.yaml:11: \"duration\" must be a duration: time: invalid duration \"forever\"",
+		"main.yaml:15: \"command\" must be a string, got a list",
+		"main.yaml:16: undefined variable \"undefined\"",
+		"main.yaml:17: unknown hash \"crc32\"",
+		"main.yaml:18: \"delete\" must be a boolean, got a string",
+		"main.yaml:19: \"quiet\" must be a boolean, got a string",
+	)
+
+	path = helperFiles(t, "main.toml", "[tasks.a]\ntype = \"print\"\nmessage = \"a\"\nmesage = \"typo\"\n")
+	_, err = Load(path)
+	helperErrors(t, err, "main.toml:4: unknown key \"mesage\"")
+
+	path = helperFiles(t, "main.toml", "[tasks.a]\ntype = \"print\"\nmessage = \n")
+	_, err = Load(path)
+	if !strings.HasPrefix(err.Error(), path+":3: ") {
+		t.Errorf("unexpected error: %s", err)
+	}
+
+	path = helperFiles(t, "main.yaml", "tasks:\n  a: {type: print}\n  a: {type: wait}\n")
+	_, err = Load(path)
+	helperErrors(t, err, "main.yaml:3: key \"a\" already defined at line 2")
+
+	path = helperFiles(t, "main.yaml", "include: [a.yaml]\ntasks: {a: {type: print, message: a}}\n", "a.yaml", "\ntasks: {a: {type: print, message: a}}\n")
+	_, err = Load(path)
+	helperErrors(t, err, "main.yaml:2: task \"a\" already defined at "+filepath.Join(filepath.Dir(path), "a.yaml")+":2")
+
+	path = helperFiles(t, "main.yaml", "include: [a.yaml]\n", "a.yaml", "include: [main.yaml]\n")
+	_, err = Load(path)
+	if !strings.Contains(err.Error(), "a.yaml:1: include loop: ") {
+		t.Errorf("unexpected error: %s", err)
+	}
+
+	path = helperFiles(t, "main.yaml", "include: [missing.yaml]\n")
+	_, err = Load(path)
+	if !errors.Is(err, os.ErrNotExist) || !strings.HasPrefix(err.Error(), path+":1: ") {
+		t.Errorf("unexpected error: %s", err)
+	}
+}
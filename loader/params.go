@@ -0,0 +1,185 @@
+package loader
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"time"
+)
+
+var variable = regexp.MustCompile(`\$\{([A-Za-z_][A-Za-z0-9_]*)\}`)
+
+// Params gives a constructor access to the keys of its task, type mismatches and
+// missing keys are recorded as errors pointing at the file, the loader reports them
+type Params struct {
+	file   string
+	line   int
+	values map[string]*value
+	keys   []string
+	vars   map[string]string
+	used   map[string]bool
+	subs   []*Params
+	errs   *Errors
+}
+
+func newParams(file string, v *value, vars map[string]string, errs *Errors) *Params {
+	values, _ := v.data.(map[string]*value)
+	return &Params{file, v.line, values, v.keys, vars, map[string]bool{}, nil, errs}
+}
+
+// Errorf records an error at the line of key, or at the line of the task if key is not set
+func (p *Params) Errorf(key, format string, args ...interface{}) {
+	line := p.line
+	if v, ok := p.values[key]; ok {
+		line = v.line
+	}
+	*p.errs = append(*p.errs, &Error{p.file, line, fmt.Errorf(format, args...)})
+}
+
+func (p *Params) Has(key string) bool {
+	_, ok := p.values[key]
+	return ok
+}
+
+// Require records an error for each missing key and tells if they were all set
+func (p *Params) Require(keys ...string) bool {
+	ok := true
+	for _, key := range keys {
+		if !p.Has(key) {
+			p.Errorf(key, "missing key %q", key)
+			ok = false
+		}
+	}
+	return ok
+}
+
+func (p *Params) get(key, kind string) (*value, bool) {
+	v, ok := p.values[key]
+	if !ok {
+		return nil, false
+	}
+	if p.used[key] = true; v.kind() != kind {
+		p.Errorf(key, "%q must be a %s, got a %s", key, kind, v.kind())
+		return nil, false
+	}
+	return v, true
+}
+
+// expand replaces the ${variables} of s
+func (p *Params) expand(key, s string) string {
+	return variable.ReplaceAllStringFunc(s, func(m string) string {
+		name := m[2 : len(m)-1]
+		value, ok := p.vars[name]
+		if !ok {
+			p.Errorf(key, "undefined variable %q", name)
+		}
+		return value
+	})
+}
+
+func (p *Params) String(key string) string {
+	if v, ok := p.get(key, "string"); ok {
+		return p.expand(key, v.data.(string))
+	}
+	return ""
+}
+
+// Strings accepts a list of strings or a single one
+func (p *Params) Strings(key string) (s []string) {
+	if v, ok := p.values[key]; ok && v.kind() == "string" {
+		return []string{p.String(key)}
+	}
+	if v, ok := p.get(key, "list"); ok {
+		for i, item := range v.data.([]*value) {
+			str, ok := item.data.(string)
+			if !ok {
+				p.Errorf(key, "%q must be a list of strings, item %d is a %s", key, i, item.kind())
+				continue
+			}
+			s = append(s, p.expand(key, str))
+		}
+	}
+	return s
+}
+
+// Map returns the string values of a map, sorted keys are returned as well
+func (p *Params) Map(key string) (map[string]string, []string) {
+	v, ok := p.get(key, "map")
+	if !ok {
+		return nil, nil
+	}
+	m, keys := map[string]string{}, []string{}
+	for _, k := range v.keys {
+		item := v.data.(map[string]*value)[k]
+		str, ok := item.data.(string)
+		if !ok {
+			p.Errorf(key, "%q must be a map of strings, %q is a %s", key, k, item.kind())
+			continue
+		}
+		m[k] = p.expand(key, str)
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return m, keys
+}
+
+func (p *Params) Bool(key string) bool {
+	if v, ok := p.get(key, "boolean"); ok {
+		return v.data.(bool)
+	}
+	return false
+}
+
+func (p *Params) Int(key string) int {
+	if v, ok := p.get(key, "integer"); ok {
+		return int(v.data.(int64))
+	}
+	return 0
+}
+
+// Float accepts integers as well
+func (p *Params) Float(key string) float64 {
+	if v, ok := p.values[key]; ok && v.kind() == "integer" {
+		return float64(p.Int(key))
+	}
+	if v, ok := p.get(key, "float"); ok {
+		return v.data.(float64)
+	}
+	return 0
+}
+
+// Duration parses a string such as "1m30s"
+func (p *Params) Duration(key string) time.Duration {
+	s := p.String(key)
+	if s == "" {
+		return 0
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil {
+		p.Errorf(key, "%q must be a duration: %s", key, err)
+	}
+	return d
+}
+
+// Sub gives access to a nested map
+func (p *Params) Sub(key string) *Params {
+	v, ok := p.get(key, "map")
+	if !ok {
+		v = &value{line: p.line}
+	}
+	sub := newParams(p.file, v, p.vars, p.errs)
+	p.subs = append(p.subs, sub)
+	return sub
+}
+
+// unused reports the keys nobody asked for, most likely typos
+func (p *Params) unused() {
+	for _, key := range p.keys {
+		if !p.used[key] {
+			p.Errorf(key, "unknown key %q", key)
+		}
+	}
+	for _, sub := range p.subs {
+		sub.unused()
+	}
+}
@@ -0,0 +1,112 @@
+package loader
+
+import (
+	"github.com/ixday/antfarm"
+	"github.com/ixday/antfarm/tasks"
+	"os"
+	"os/exec"
+)
+
+type (
+	// Constructor builds a task out of its keys, errors are recorded through the params
+	Constructor func(*Params) antfarm.Task
+
+	// Registry maps the type of the tasks found in a file to their constructor
+	Registry map[string]Constructor
+)
+
+// Builtins returns a new registry holding the tasks of the tasks package
+func Builtins() Registry {
+	return Registry{
+		"command": commandTask,
+		"copy":    copyTask,
+		"print":   printTask,
+		"sync":    syncTask,
+		"wait":    waitTask,
+	}
+}
+
+// commandTask runs a program, its output goes to the one of the current process.
+// Prefix marks its lines with the name of the task, quiet only shows them if it fails.
+func commandTask(p *Params) antfarm.Task {
+	if !p.Require("command") {
+		return nil
+	}
+	name, args, dir, env := p.String("command"), p.Strings("args"), p.String("dir"), p.Strings("env")
+	prefix, color, quiet := p.Bool("prefix"), p.Bool("color"), p.Bool("quiet")
+	option := func(cmd *exec.Cmd) {
+		cmd.Args = append(cmd.Args, args...)
+		cmd.Dir = dir
+		if env != nil {
+			cmd.Env = append(os.Environ(), env...)
+		}
+	}
+	if !prefix && !quiet {
+		return tasks.Command(name, option, func(cmd *exec.Cmd) { cmd.Stdout, cmd.Stderr = os.Stdout, os.Stderr })
+	}
+	return tasks.CommandOutput(name, func(opts *tasks.OutputOpts) {
+		opts.NoPrefix, opts.Color, opts.OnFailure = !prefix, color, quiet
+	}, option)
+}
+
+// copyTask compares the files when checksum names a hash, see tasks.Hashes
+func copyTask(p *Params) antfarm.Task {
+	if !p.Require("src", "dest") {
+		return nil
+	}
+	src, dest := p.String("src"), p.String("dest")
+	if !p.Has("checksum") {
+		return tasks.FileCopy(src, dest)
+	}
+	hash, ok := hashKey(p)
+	if !ok {
+		return nil
+	}
+	return tasks.FileCopyChecksum(src, dest, func(opts *tasks.ChecksumOpts) { opts.Hash = hash })
+}
+
+// syncTask mirrors a directory, preserve keeps modes, times and symlinks as rsync -a does
+func syncTask(p *Params) antfarm.Task {
+	if !p.Require("src", "dest") {
+		return nil
+	}
+	src, dest, preserve := p.String("src"), p.String("dest"), p.Bool("preserve")
+	include, exclude, remove, dryRun := p.Strings("include"), p.Strings("exclude"), p.Bool("delete"), p.Bool("dry_run")
+	checksum := p.Has("checksum")
+	hash, ok := tasks.SHA256, true
+	if checksum {
+		hash, ok = hashKey(p)
+	}
+	if !ok {
+		return nil
+	}
+	return tasks.Sync(src, dest, func(opts *tasks.SyncOpts) {
+		opts.Include, opts.Exclude, opts.Delete, opts.DryRun = include, exclude, remove, dryRun
+		opts.Checksum, opts.Hash = checksum, hash
+		opts.PreserveModes, opts.PreserveTimes, opts.PreserveLinks = preserve, preserve, preserve
+	})
+}
+
+// hashKey looks up the algorithm named by the checksum key
+func hashKey(p *Params) (tasks.Hash, bool) {
+	name := p.String("checksum")
+	hash, ok := tasks.Hashes[name]
+	if !ok {
+		p.Errorf("checksum", "unknown hash %q", name)
+	}
+	return hash, ok
+}
+
+func printTask(p *Params) antfarm.Task {
+	if !p.Require("message") {
+		return nil
+	}
+	return tasks.Print(p.String("message"))
+}
+
+func waitTask(p *Params) antfarm.Task {
+	if !p.Require("duration") {
+		return nil
+	}
+	return tasks.Wait(p.Duration("duration"))
+}
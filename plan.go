@@ -0,0 +1,103 @@
+package antfarm
+
+import (
+	"fmt"
+	"strings"
+)
+
+type (
+	Step struct {
+		Name   string
+		Deps   []string
+		Wave   int    // steps of the same wave can run in parallel
+		Run    bool   // whether the task would be started
+		Reason string // why the task would run or not
+		Err    error  // returned by the expectation
+	}
+
+	Plan struct {
+		Steps []Step     // in resolution order
+		Waves [][]string // names of the steps grouped by wave
+	}
+)
+
+// Plan resolves the targets and asks every provisioner if some work is needed, nothing is run.
+// Expectations and fingerprints are checked before any dependency runs, the actual run may differ.
+func (runner Runner) Plan(tasks ...string) (Plan, error) {
+	var plan Plan
+	resolved, err := runner.Resolve(Node{Deps: tasks})
+	if err != nil {
+		return plan, err
+	}
+
+	var state *fingerprints
+	resolved = resolved[:len(resolved)-1] // root is last
+	for _, name := range resolved {
+		if runner.nodes[name].tracked() {
+			state = runner.state()
+			break
+		}
+	}
+
+	waves, changed := map[string]int{}, map[string]bool{}
+	for _, name := range resolved {
+		node := runner.nodes[name]
+		step := Step{Name: name, Deps: node.Deps, Run: true, Reason: "no expectation"}
+		for _, dep := range node.Deps {
+			if waves[dep] >= step.Wave {
+				step.Wave = waves[dep] + 1
+			}
+		}
+		if state != nil {
+			stale, reason, err := state.stale(node, changed)
+			switch changed[name] = stale; {
+			case err != nil:
+				step.Reason, step.Err = "fingerprint failed", err
+			case !stale && node.tracked():
+				step.Run, step.Reason = false, reason
+			case stale:
+				step.Reason = reason
+			}
+		}
+		if expecter, ok := node.Task.(Expecter); ok && step.Run && step.Err == nil {
+			switch ok, err := expecter.Expect(); {
+			case err != nil:
+				step.Reason, step.Err = "expectation failed", err
+			case ok:
+				step.Reason = "expectation not met"
+			default:
+				step.Run, step.Reason = false, "already satisfied"
+			}
+		}
+
+		waves[name] = step.Wave
+		if step.Wave == len(plan.Waves) {
+			plan.Waves = append(plan.Waves, nil)
+		}
+		plan.Waves[step.Wave] = append(plan.Waves[step.Wave], name)
+		plan.Steps = append(plan.Steps, step)
+	}
+	return plan, nil
+}
+
+func (plan Plan) String() string {
+	var b strings.Builder
+	steps := map[string]Step{}
+	for _, step := range plan.Steps {
+		steps[step.Name] = step
+	}
+	for i, wave := range plan.Waves {
+		fmt.Fprintf(&b, "wave %d:\n", i+1)
+		for _, name := range wave {
+			step, action := steps[name], "run"
+			if !step.Run {
+				action = "skip"
+			}
+			if fmt.Fprintf(&b, "  %s %s: %s", action, name, step.Reason); step.Err != nil {
+				fmt.Fprintf(&b, " (%s)", step.Err)
+			}
+			b.WriteString("\n")
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,54 @@
+package antfarm
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestPlan(t *testing.T) {
+	ErrQux := errors.New("qux")
+	runner := Runner{}.
+		Task("foo", noop()).
+		Task("bar", Provision(NewMockProvisioner(func(mp *MockProvisioner) { mp.ExpectOk = false })), "foo").
+		Task("baz", Provision(NewMockProvisioner()), "foo").
+		Task("qux", Provision(NewMockProvisioner(func(mp *MockProvisioner) { mp.ExpectErr = ErrQux })), "bar", "baz")
+
+	plan, err := runner.Plan("qux")
+	unexpectedErr(t, err, nil)
+
+	if len(plan.Waves) != 3 {
+		t.Fatalf("unexpected number of waves, got: %d", len(plan.Waves))
+	}
+	compare(t, plan.Waves[0], []string{"foo"})
+	compare(t, plan.Waves[1], []string{"bar", "baz"})
+	compare(t, plan.Waves[2], []string{"qux"})
+
+	expected := "wave 1:\n" +
+		"  run foo: no expectation\n" +
+		"wave 2:\n" +
+		"  skip bar: already satisfied\n" +
+		"  run baz: expectation not met\n" +
+		"wave 3:\n" +
+		"  run qux: expectation failed (qux)\n"
+	if plan.String() != expected {
+		t.Errorf("unexpected plan, got:\n%s\nexpected:\n%s", plan, expected)
+	}
+	if plan.Steps[3].Err != ErrQux {
+		t.Errorf("unexpected error type, got: %s, expected: %s", plan.Steps[3].Err, ErrQux)
+	}
+}
+
+func TestPlanDoesNotRun(t *testing.T) {
+	mp := NewMockProvisioner()
+	_, err := Runner{}.Task("foo", Provision(mp)).Plan("foo")
+	unexpectedErr(t, err, nil)
+	if !mp.expectCalled || mp.startCalled {
+		t.Errorf("plan should only check the expectation")
+	}
+}
+
+func TestPlanDependencyErr(t *testing.T) {
+	if _, err := (Runner{}).Task("foo", noop(), "bar").Plan("foo"); !errors.Is(err, ErrDepNotFound) {
+		t.Errorf("unexpected error type, got: %s, expected: %s", err, ErrDepNotFound)
+	}
+}
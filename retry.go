@@ -0,0 +1,70 @@
+package antfarm
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"time"
+)
+
+type (
+	RetryPolicy struct {
+		Attempts  int              // maximum number of attempts, including the first one
+		Delay     time.Duration    // wait before the second attempt, doubled after each failure
+		MaxDelay  time.Duration    // upper bound of the wait, unbounded if not set
+		Jitter    float64          // fraction of the wait which is randomized, between 0 and 1
+		Retryable func(error) bool // decide which errors are worth retrying, all of them if not set
+	}
+
+	RetryError struct {
+		Errors []error // error of every attempt, in order
+	}
+)
+
+func (e *RetryError) Error() string {
+	return fmt.Sprintf("failed after %d attempt(s): %s", len(e.Errors), e.Unwrap())
+}
+
+func (e *RetryError) Unwrap() error { return e.Errors[len(e.Errors)-1] }
+
+func (policy RetryPolicy) backoff(attempt int) time.Duration {
+	delay := policy.Delay
+	for i := 1; i < attempt && (policy.MaxDelay == 0 || delay < policy.MaxDelay); i++ {
+		delay *= 2
+	}
+	if policy.MaxDelay > 0 && delay > policy.MaxDelay {
+		delay = policy.MaxDelay
+	}
+	if jitter := policy.Jitter; jitter > 0 {
+		if jitter > 1 {
+			jitter = 1
+		}
+		delay -= time.Duration(jitter * rand.Float64() * float64(delay))
+	}
+	return delay
+}
+
+func Retry(task Task, policy RetryPolicy) Task {
+	return TaskFunc(func(ctx context.Context) error {
+		var errs []error
+		for attempt := 1; ; attempt++ {
+			err := task.Start(ctx)
+			if err == nil {
+				return nil
+			}
+			errs = append(errs, err)
+			if attempt >= policy.Attempts || ctx.Err() != nil ||
+				policy.Retryable != nil && !policy.Retryable(err) {
+				return &RetryError{errs}
+			}
+
+			timer := time.NewTimer(policy.backoff(attempt))
+			select {
+			case <-timer.C:
+			case <-ctx.Done(): // stop waiting as soon as the run is canceled
+				timer.Stop()
+				return &RetryError{errs}
+			}
+		}
+	})
+}
@@ -0,0 +1,89 @@
+package antfarm
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+)
+
+func flaky(failures int, err error) (Task, *int) {
+	attempts := 0
+	return TaskFunc(func(_ context.Context) error {
+		if attempts++; attempts <= failures {
+			return err
+		}
+		return nil
+	}), &attempts
+}
+
+func TestRetry(t *testing.T) {
+	task, attempts := flaky(2, fmt.Errorf("foo"))
+	unexpectedErr(t, Retry(task, RetryPolicy{Attempts: 3}).Start(context.Background()), nil)
+	if *attempts != 3 {
+		t.Errorf("unexpected number of attempts, got: %d, expected: %d", *attempts, 3)
+	}
+}
+
+func TestRetryExhausted(t *testing.T) {
+	ErrFoo := fmt.Errorf("foo")
+	task, _ := flaky(5, ErrFoo)
+	err := Retry(task, RetryPolicy{Attempts: 3, Delay: time.Millisecond}).Start(context.Background())
+
+	var retry *RetryError
+	if !errors.As(err, &retry) || len(retry.Errors) != 3 {
+		t.Fatalf("every attempt should be recorded, got: %s", err)
+	}
+	if !errors.Is(err, ErrFoo) {
+		t.Errorf("unexpected error type, got: %s, expected: %s", err, ErrFoo)
+	}
+}
+
+func TestRetryNotRetryable(t *testing.T) {
+	task, attempts := flaky(5, fmt.Errorf("foo"))
+	policy := RetryPolicy{Attempts: 3, Retryable: func(error) bool { return false }}
+	if err := Retry(task, policy).Start(context.Background()); err == nil {
+		t.Errorf("task should have failed")
+	}
+	if *attempts != 1 {
+		t.Errorf("unexpected number of attempts, got: %d, expected: %d", *attempts, 1)
+	}
+}
+
+func TestRetryCancel(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(10*time.Millisecond, cancel)
+	task, attempts := flaky(5, fmt.Errorf("foo"))
+
+	start := time.Now()
+	Retry(task, RetryPolicy{Attempts: 3, Delay: time.Minute}).Start(ctx)
+	if time.Since(start) > time.Second {
+		t.Errorf("backoff should have stopped on cancellation")
+	}
+	if *attempts != 1 {
+		t.Errorf("unexpected number of attempts, got: %d, expected: %d", *attempts, 1)
+	}
+}
+
+func TestRetryBackoff(t *testing.T) {
+	policy := RetryPolicy{Delay: time.Second, MaxDelay: 5 * time.Second}
+	for attempt, expected := range []time.Duration{time.Second, 2 * time.Second, 4 * time.Second, 5 * time.Second} {
+		if delay := policy.backoff(attempt + 1); delay != expected {
+			t.Errorf("unexpected delay for attempt %d, got: %s, expected: %s", attempt+1, delay, expected)
+		}
+	}
+
+	policy.Jitter = 0.5
+	for i := 0; i < 10; i++ {
+		if delay := policy.backoff(1); delay < time.Second/2 || delay > time.Second {
+			t.Errorf("jitter out of bounds, got: %s", delay)
+		}
+	}
+}
+
+func TestNodeRetry(t *testing.T) {
+	task, _ := flaky(1, fmt.Errorf("foo"))
+	err := Runner{}.Add(Node{Name: "foo", Task: task, Retry: RetryPolicy{Attempts: 2}}).Start("foo")
+	unexpectedErr(t, err, nil)
+}
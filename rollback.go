@@ -0,0 +1,60 @@
+package antfarm
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+type (
+	// Undoer is implemented by the provisioners able to revert what they applied, see Runner.Transactional
+	Undoer interface {
+		Undo() error
+	}
+
+	// RollbackError is returned when the run failed and some of its tasks could not be undone
+	RollbackError struct {
+		Err  error      // failure of the run
+		Undo TaskErrors // failures of the rollback, also found in the report
+	}
+
+	journalKey struct{}
+	journal    func(Undoer)
+)
+
+func (e *RollbackError) Error() string { return fmt.Sprintf("%s; rollback failed: %s", e.Err, e.Undo) }
+func (e *RollbackError) Unwrap() error { return e.Err }
+
+// record lets the provisioners started by a transactional run register what to undo
+func record(ctx context.Context, undoer Undoer) {
+	if r, ok := ctx.Value(journalKey{}).(journal); ok {
+		r(undoer)
+	}
+}
+
+// rollback undoes the tasks in reverse topological order, the provisioners of a task in reverse order of application
+func (run *Run) rollback() (undone []string, errs TaskErrors) {
+	run.undoing.Lock()
+	defer run.undoing.Unlock()
+	for _, name := range reverse(run.resolved) {
+		undoers := run.undos[name]
+		if len(undoers) == 0 {
+			continue
+		}
+		var failed error
+		for i := len(undoers) - 1; i >= 0; i-- {
+			if err := undoers[i].Undo(); err != nil {
+				errs = append(errs, &TaskError{Name: name, Err: err})
+				failed = err
+			}
+		}
+		if run.state != nil { // run again next time, whatever its files look like
+			run.state.forget(name)
+		}
+		run.emit(name, Undone, time.Time{}, failed)
+		if failed == nil {
+			undone = append(undone, name)
+		}
+	}
+	return undone, errs
+}
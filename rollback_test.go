@@ -0,0 +1,91 @@
+package antfarm
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+)
+
+// undoable provisions by appending its name to the log, and removes it on undo
+type undoable struct {
+	name    string
+	applied bool // expectation already met
+	undoErr error
+	log     *undoLog
+}
+
+type undoLog struct {
+	sync.Mutex
+	undone []string
+}
+
+func (u undoable) Expect() (bool, error)         { return !u.applied, nil }
+func (u undoable) Start(_ context.Context) error { return nil }
+func (u undoable) Abort()                        {}
+func (u undoable) Undo() error {
+	u.log.Lock()
+	defer u.log.Unlock()
+	u.log.undone = append(u.log.undone, u.name)
+	return u.undoErr
+}
+
+func TestRollback(t *testing.T) {
+	ErrFoo := fmt.Errorf("foo")
+	log := &undoLog{}
+	runner := Runner{Transactional: true}.
+		Task("a", Provision(undoable{name: "a", log: log})).
+		Task("b", TaskFunc(func(ctx context.Context) error { // two provisioners for a single task
+			for _, name := range []string{"b1", "b2"} {
+				if err := Provision(undoable{name: name, log: log}).Start(ctx); err != nil {
+					return err
+				}
+			}
+			return nil
+		}), "a").
+		Task("c", Provision(undoable{name: "c", applied: true, log: log}), "b"). // satisfied, nothing to undo
+		Task("d", Error(ErrFoo), "c")
+
+	report, err := runner.Execute("d")
+	if !errors.Is(err, ErrFoo) {
+		t.Errorf("unexpected error type, got: %s, expected: %s", err, ErrFoo)
+	}
+	compare(t, log.undone, []string{"b2", "b1", "a"})
+	compare(t, report.Undone, []string{"b", "a"})
+	if report.UndoFailed != nil {
+		t.Errorf("unexpected rollback failures, got: %s", report.UndoFailed)
+	}
+
+	log.undone = nil
+	runner.Transactional = false
+	if _, err := runner.Execute("d"); !errors.Is(err, ErrFoo) || log.undone != nil {
+		t.Errorf("nothing should be undone without transaction, got: %s %s", err, log.undone)
+	}
+	if _, err := runner.Execute("c"); err != nil || log.undone != nil {
+		t.Errorf("nothing should be undone on success, got: %s %s", err, log.undone)
+	}
+}
+
+func TestRollbackError(t *testing.T) {
+	ErrFoo, ErrUndo := fmt.Errorf("foo"), fmt.Errorf("undo")
+	log := &undoLog{}
+	report, err := Runner{Transactional: true}.
+		Task("a", Provision(undoable{name: "a", log: log})).
+		Task("b", Provision(undoable{name: "b", undoErr: ErrUndo, log: log}), "a").
+		Task("c", Error(ErrFoo), "b").
+		Execute("c")
+
+	var rollbackErr *RollbackError
+	if !errors.As(err, &rollbackErr) || !errors.Is(err, ErrFoo) {
+		t.Fatalf("unexpected error type, got: %s", err)
+	}
+	if errors.Is(err, ErrUndo) || !errors.Is(rollbackErr.Undo, ErrUndo) {
+		t.Errorf("rollback failures should be kept apart, got: %s", err)
+	}
+	compare(t, log.undone, []string{"b", "a"}) // keeps going after a failed undo
+	compare(t, report.Undone, []string{"a"})
+	if len(report.Failed) != 1 || len(report.UndoFailed) != 1 || report.UndoFailed[0].Name != "b" {
+		t.Errorf("unexpected report, got: %s, %s", report.Failed, report.UndoFailed)
+	}
+}
@@ -0,0 +1,328 @@
+package antfarm
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+var ErrRunStarted = fmt.Errorf("run already started")
+
+type (
+	// Run is a single execution of some targets, the runner it comes from is left untouched
+	Run struct {
+		runner   Runner
+		targets  []string
+		resolved []string
+		started  int32
+
+		nodes   map[string]Node // graph of the run, internal tasks included
+		running map[string]*state
+		state   *fingerprints // nil when no task has inputs or outputs
+		done    chan result
+		events  sync.Mutex          // listeners are called one at a time
+		undos   map[string][]Undoer // provisioners applied by each task, when transactional
+		undoing sync.Mutex
+		shared  *shared
+	}
+
+	status int
+
+	state struct {
+		ctx context.Context
+		context.CancelFunc
+		Done   chan bool
+		status status // set before Done is closed
+	}
+
+	// detached carries the values and deadline of its parent, cancellation is left to the runner
+	detached struct{ parent context.Context }
+
+	result struct {
+		name      string
+		err       error
+		cancelled bool
+	}
+)
+
+const (
+	pending status = iota
+	succeeded
+	failed
+	skipped
+)
+
+func (s status) String() string {
+	switch s {
+	case succeeded:
+		return "succeeded"
+	case failed:
+		return "failed"
+	case skipped:
+		return "skipped"
+	}
+	return "pending"
+}
+
+func (d detached) Deadline() (time.Time, bool)       { return d.parent.Deadline() }
+func (d detached) Done() <-chan struct{}             { return nil }
+func (d detached) Err() error                        { return nil }
+func (d detached) Value(key interface{}) interface{} { return d.parent.Value(key) }
+
+// NewRun resolves the targets, the returned run can be started once
+func (runner Runner) NewRun(tasks ...string) (*Run, error) {
+	for name, node := range runner.nodes {
+		if reserved(name) {
+			return nil, fmt.Errorf("%w: %q", ErrReserved, name)
+		}
+		for _, dep := range node.Deps {
+			if reserved(dep) {
+				return nil, fmt.Errorf("%w: %q", ErrReserved, dep)
+			}
+		}
+	}
+
+	resolved, err := runner.Resolve(Node{Deps: tasks})
+	if err != nil {
+		return nil, err
+	}
+	return &Run{runner: runner, targets: tasks, resolved: append(resolved, abortName)}, nil
+}
+
+// gather the job slots and the resources each task needs to hold while running
+func (run *Run) locks() map[string]claims {
+	locks := map[string]claims{}
+	slots := newSemaphore(run.runner.Jobs)
+	resources := map[string]*semaphore{}
+
+	for _, name := range run.resolved {
+		if internal(name) {
+			continue
+		}
+		node := run.nodes[name]
+		for _, resource := range sorted(node.Resources) { // same order everywhere to avoid deadlocks
+			if _, ok := resources[resource]; !ok {
+				capacity, ok := run.runner.Resources[resource]
+				if !ok {
+					capacity = 1
+				}
+				resources[resource] = newSemaphore(capacity)
+			}
+			locks[name] = append(locks[name], claim{resources[resource], 1})
+		}
+		locks[name] = append(locks[name], claim{slots, node.Weight}) // slots last, not to hold them while waiting
+	}
+	return locks
+}
+
+func (run *Run) emit(name string, kind EventKind, since time.Time, err error) {
+	if internal(name) || len(run.runner.Listeners) == 0 {
+		return
+	}
+	run.events.Lock()
+	defer run.events.Unlock()
+	now := time.Now()
+	event := Event{Task: name, Kind: kind, Time: now, Err: err}
+	if !since.IsZero() {
+		event.Duration = now.Sub(since)
+	}
+	for _, listener := range run.runner.Listeners {
+		listener.Event(event)
+	}
+}
+
+func (run *Run) exec(node Node, s *state, locks claims) {
+	defer close(s.Done)
+	for _, dep := range node.Deps {
+		select {
+		case <-s.ctx.Done(): // if interrupt don't wait any longer
+			run.emit(node.Name, Cancelled, time.Time{}, s.ctx.Err())
+			return
+		case <-run.running[dep].Done: // wait for dependencies to finish
+		}
+	}
+	for _, dep := range node.Deps {
+		if run.running[dep].status != succeeded { // a dependency did not complete, do not start
+			s.status = skipped
+			run.emit(node.Name, Skipped, time.Time{}, nil)
+			return
+		}
+	}
+	queued := time.Now()
+	run.emit(node.Name, Queued, time.Time{}, nil)
+	if err := locks.Acquire(s.ctx); err != nil { // canceled while waiting
+		run.emit(node.Name, Cancelled, queued, err)
+		return
+	}
+	defer locks.Release()
+	ctx := s.ctx
+	if node.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, node.Timeout)
+		defer cancel()
+	}
+	task := node.Task
+	if node.Retry.Attempts > 1 {
+		task = Retry(task, node.Retry)
+	}
+	if run.state != nil && !internal(node.Name) {
+		task = run.state.track(node, task)
+	}
+	started := time.Now()
+	run.emit(node.Name, Started, queued, nil)
+	ctx = context.WithValue(ctx, reporterKey{}, reporter(func(kind EventKind) {
+		run.emit(node.Name, kind, started, nil)
+	}))
+	ctx = context.WithValue(ctx, nameKey{}, node.Name)
+	ctx = context.WithValue(ctx, sharedKey{}, run.shared)
+	if run.runner.Transactional {
+		ctx = context.WithValue(ctx, journalKey{}, journal(func(undoer Undoer) {
+			run.undoing.Lock()
+			defer run.undoing.Unlock()
+			run.undos[node.Name] = append(run.undos[node.Name], undoer)
+		}))
+	}
+	err := task.Start(ctx) // start job
+	if err != nil && ctx.Err() == context.DeadlineExceeded && s.ctx.Err() == nil {
+		err = &TimeoutError{node.Name, node.Timeout, err}
+	}
+	kind, status, cause := Succeeded, succeeded, err
+	switch {
+	case err != nil && s.ctx.Err() != nil:
+		kind, status = Cancelled, failed
+	case err != nil:
+		kind, status = Failed, failed
+	case s.ctx.Err() != nil: // returned without an error once canceled, its work may not be done
+		kind, status, cause = Cancelled, skipped, s.ctx.Err()
+	}
+	s.status = status
+	run.emit(node.Name, kind, started, cause)
+	run.done <- result{node.Name, err, s.ctx.Err() != nil}
+}
+
+func (run *Run) clean(forced chan bool) (errs TaskErrors) {
+	var cleaning bool
+	cleaned := make(chan bool)
+	collect := func(r result) {
+		if r.err != nil {
+			errs = append(errs, &TaskError{r.name, r.err, r.cancelled})
+		}
+	}
+	drain := func() { // results are sent before the tasks are marked as done
+		for {
+			select {
+			case r := <-run.done:
+				collect(r)
+			default:
+				return
+			}
+		}
+	}
+
+	for {
+		select {
+		case r := <-run.done:
+			collect(r)
+			if r.err == nil || cleaning || run.runner.KeepGoing && r.name != abortName { // ensure only one cleaning is running, ^C always cleans
+				continue
+			}
+			cleaning = true
+			go func() {
+				defer close(cleaned)                         // close channel only when all tasks are canceled
+				for _, name := range reverse(run.resolved) { // ensure all task are closed
+					run.running[name].CancelFunc()
+					<-run.running[name].Done
+				}
+			}()
+		case <-run.running[""].Done:
+			if !cleaning { // if an error exists, there's a cleaning running
+				drain()
+				return
+			}
+		case <-cleaned:
+			drain()
+			return
+		case <-forced: // stop waiting for the tasks, cancel them all at once
+			for _, s := range run.running {
+				s.CancelFunc()
+			}
+			if drain(); !errs.Is(ErrInterrupt) {
+				errs = append(errs, &TaskError{Name: abortName, Err: ErrInterrupt})
+			}
+			return
+		}
+	}
+}
+
+func (run *Run) Start(parent context.Context) (Report, error) {
+	if !atomic.CompareAndSwapInt32(&run.started, 0, 1) {
+		return Report{}, ErrRunStarted
+	}
+
+	stop := make(chan bool)
+	defer close(stop)
+	interrupt := run.runner.Signal.notify(stop)
+
+	run.nodes = map[string]Node{
+		"":        {Task: noop(), Deps: run.targets},
+		abortName: {Name: abortName, Task: run.runner.abort(parent, interrupt)},
+	}
+	run.running = map[string]*state{}
+	run.undos = map[string][]Undoer{}
+	run.shared = &shared{values: map[interface{}]interface{}{}}
+	run.done = make(chan result, len(run.resolved)) // never block a task once the run is over
+
+	for _, name := range run.resolved {
+		if !internal(name) {
+			if run.nodes[name] = run.runner.nodes[name]; run.nodes[name].tracked() && run.state == nil {
+				run.state = run.runner.state()
+			}
+		}
+		ctx, cancel := context.WithCancel(detached{parent})
+		run.running[name] = &state{ctx: ctx, CancelFunc: cancel, Done: make(chan bool)}
+	}
+
+	locks := run.locks()
+	for _, name := range run.resolved {
+		go run.exec(run.nodes[name], run.running[name], locks[name])
+	}
+
+	errs := run.clean(interrupt.second)
+	var report Report
+	if errs != nil && run.runner.Transactional {
+		report.Undone, report.UndoFailed = run.rollback()
+	}
+	if run.state != nil {
+		if err := run.state.save(); err != nil {
+			errs = append(errs, &TaskError{Name: stateName, Err: err})
+		}
+	}
+	report.Failed = errs
+	for _, name := range run.resolved {
+		if run.running[name].CancelFunc(); internal(name) {
+			continue
+		}
+		select {
+		case <-run.running[name].Done:
+		default: // abandoned after a forced interruption
+			report.Skipped = append(report.Skipped, name)
+			continue
+		}
+		switch run.running[name].status {
+		case succeeded:
+			report.Succeeded = append(report.Succeeded, name)
+		case pending, skipped:
+			report.Skipped = append(report.Skipped, name)
+		}
+	}
+
+	switch {
+	case report.UndoFailed != nil:
+		return report, &RollbackError{errs, report.UndoFailed}
+	case errs != nil:
+		return report, errs
+	}
+	return report, nil
+}
@@ -0,0 +1,49 @@
+package antfarm
+
+import (
+	"context"
+	"sync"
+	"testing"
+)
+
+func TestRunConcurrent(t *testing.T) {
+	var wg sync.WaitGroup
+	runner := Runner{}.
+		Task("foo", noop()).
+		Task("bar", noop(), "foo").
+		Task("baz", noop(), "foo")
+
+	for i := 0; i < 10; i++ {
+		for _, target := range []string{"bar", "baz"} {
+			wg.Add(1)
+			go func(target string) {
+				defer wg.Done()
+				unexpectedErr(t, runner.Start(target), nil)
+			}(target)
+		}
+	}
+	wg.Wait()
+
+	if len(runner.nodes) != 3 {
+		t.Errorf("runs should not modify the runner, got: %d tasks", len(runner.nodes))
+	}
+}
+
+func TestRunStartedTwice(t *testing.T) {
+	run, err := Runner{}.Task("foo", noop()).NewRun("foo")
+	unexpectedErr(t, err, nil)
+	_, err = run.Start(context.Background())
+	unexpectedErr(t, err, nil)
+	_, err = run.Start(context.Background())
+	unexpectedErr(t, err, ErrRunStarted)
+}
+
+func TestRunnerImmutable(t *testing.T) {
+	foo := Runner{}.Task("foo", noop())
+	bar := foo.Task("bar", noop(), "foo")
+
+	if _, ok := foo.nodes["bar"]; ok {
+		t.Errorf("adding a task should not modify the original runner")
+	}
+	unexpectedErr(t, bar.Start("bar"), nil)
+}
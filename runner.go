@@ -3,28 +3,58 @@ package antfarm
 import (
 	"context"
 	"fmt"
-	"os"
-	"os/signal"
+	"sort"
+	"strings"
+	"time"
 )
 
 var (
 	ErrDepNotFound = fmt.Errorf("dependency not found")
 	ErrDepCircular = fmt.Errorf("circular dependency detected")
 	ErrInterrupt   = fmt.Errorf("Aborting due to ^C...")
+	ErrTimeout     = fmt.Errorf("timed out")
+	ErrReserved    = fmt.Errorf("task name is reserved")
 )
 
 type (
 	Node struct {
-		Name string
-		Task Task
-		Deps []string
+		Name      string
+		Task      Task
+		Deps      []string
+		Weight    int           // slots taken when the runner limits its jobs, defaults to 1
+		Resources []string      // shared resources held while running, see Runner.Resources
+		Timeout   time.Duration // maximum running time of the task, not counting the wait for its dependencies
+		Retry     RetryPolicy   // attempts made before failing, only once if not set
+		Inputs    []string      // globs of the files read, the task is skipped when they and the outputs did not change
+		Outputs   []string      // files or directories produced, dependents are rebuilt when they change
+
+		Description string
+		Tags        []string
+		Hidden      bool              // helper task, not listed to the user
+		Annotations map[string]string // free form metadata, not used by the runner
 	}
 
-	Runner map[string]Node
+	Runner struct {
+		KeepGoing bool           // do not cancel the run on failure, only skip the dependents
+		Jobs      int            // maximum number of slots used at once, unlimited if not set
+		Resources map[string]int // capacity of each named resource, undeclared ones act as mutexes
+		Timeout   time.Duration  // maximum duration of the whole run
+		Signal    SignalOpts
+		Listeners []Listener // notified of every task event, see EventKind
+		State     string     // fingerprints of the tasks having inputs or outputs, DefaultState if not set
+
+		// undo the provisioners which changed state when the run fails, see Undoer
+		Transactional bool
+		nodes         map[string]Node
+	}
+
+	Report struct {
+		Succeeded []string
+		Failed    TaskErrors
+		Skipped   []string // not started because a dependency failed or the run was canceled, or interrupted without an error
 
-	state struct {
-		context.CancelFunc
-		Done chan bool
+		Undone     []string   // rolled back once the run failed, see Runner.Transactional
+		UndoFailed TaskErrors // tasks whose rollback failed, kept apart from the failures of the run
 	}
 )
 
@@ -46,105 +76,137 @@ func reverse(array []string) []string {
 	return out
 }
 
+func sorted(array []string) []string {
+	out := append([]string(nil), array...)
+	sort.Strings(out)
+	return out
+}
+
+func internal(name string) bool { return name == "" || name == abortName }
+
+// the root of a run is nameless, other internal tasks live in their own namespace
+func reserved(name string) bool { return name == "" || strings.HasPrefix(name, "antfarm:") }
+
 func (r Runner) Task(name string, task Task, deps ...string) Runner {
-	r[name] = Node{name, task, deps}
+	return r.Add(Node{Name: name, Task: task, Deps: deps})
+}
+
+// Add returns a new runner, graphs are never modified once built so runs can share them
+func (r Runner) Add(node Node) Runner {
+	nodes := make(map[string]Node, len(r.nodes)+1)
+	for name, n := range r.nodes {
+		nodes[name] = n
+	}
+	if node.Weight < 1 {
+		node.Weight = 1
+	}
+	nodes[node.Name] = node
+	r.nodes = nodes
 	return r
 }
 
+func (r Runner) Lookup(name string) (Node, bool) {
+	node, ok := r.nodes[name]
+	return node, ok
+}
+
+// Nodes returns every task of the runner sorted by name
+func (r Runner) Nodes() []Node {
+	nodes := make([]Node, 0, len(r.nodes))
+	for _, node := range r.nodes {
+		nodes = append(nodes, node)
+	}
+	sort.Slice(nodes, func(i, j int) bool { return nodes[i].Name < nodes[j].Name })
+	return nodes
+}
+
+// Tagged returns the names of the tasks having the tag, sorted
+func (r Runner) Tagged(tag string) []string {
+	var names []string
+	for _, node := range r.Nodes() {
+		if node.HasTag(tag) {
+			names = append(names, node.Name)
+		}
+	}
+	return names
+}
+
+func (node Node) HasTag(tag string) bool { return in(tag, node.Tags) }
+
 func (r Runner) Resolve(node Node) ([]string, error) {
 	var seen, resolved []string
+	var missing DependencyErrors
 	var resolve func(node Node) error
 
 	resolve = func(node Node) error {
+		var notFound []string
 		seen = append(seen, node.Name)
 		for _, dep := range node.Deps {
 			if !in(dep, resolved) {
 				if in(dep, seen) {
-					return ErrDepCircular
+					return &CycleError{cycle(seen, resolved, dep)}
 				}
-				node, ok := r[dep]
+				node, ok := r.nodes[dep]
 				if !ok {
-					return ErrDepNotFound
+					notFound = append(notFound, dep)
+					continue
 				}
 				if err := resolve(node); err != nil {
 					return err
 				}
 			}
 		}
+		if notFound != nil {
+			missing = append(missing, &DependencyNotFoundError{node.Name, notFound})
+		}
 		resolved = append(resolved, node.Name)
 		return nil
 	}
-	return resolved, resolve(node)
+	if err := resolve(node); err != nil {
+		return resolved, err
+	}
+	switch len(missing) {
+	case 0:
+		return resolved, nil
+	case 1:
+		return resolved, missing[0]
+	}
+	return resolved, missing
 }
 
-func clean(running map[string]state, resolved []string, done chan error) (err error) {
-	cleaned := make(chan bool)
-	for {
-		select {
-		case e := <-done:
-			if e == nil || err != nil { // ensure only one cleaning is running
-				continue
-			}
-			err = e // save error
-			go func() {
-				defer close(cleaned)                     // close channel only when all tasks are canceled
-				for _, name := range reverse(resolved) { // ensure all task are closed
-					running[name].CancelFunc()
-					<-running[name].Done
-				}
-			}()
-		case <-running[""].Done:
-			if err == nil { // if an error exists, there's a cleaning running
-				return
+// nodes seen but not resolved yet form the current path, extract the loop from it
+func cycle(seen, resolved []string, dep string) []string {
+	var path []string
+	for _, name := range seen {
+		if name == dep || path != nil {
+			if !in(name, resolved) {
+				path = append(path, name)
 			}
-		case <-cleaned:
-			return
 		}
 	}
-}
-
-func abort() Task {
-	return TaskFunc(func(ctx context.Context) error {
-		interrupt := make(chan os.Signal)
-		signal.Notify(interrupt, os.Interrupt)
-		select {
-		case <-interrupt:
-			return ErrInterrupt
-		case <-ctx.Done():
-		}
-		return nil
-	})
+	return append(path, dep)
 }
 
 func noop() Task { return TaskFunc(func(_ context.Context) error { return nil }) }
 
 func (runner Runner) Start(tasks ...string) error {
-	done := make(chan error)
-	running := map[string]state{}
-	root := runner.Task("abort", abort()).Task("", noop(), tasks...)[""]
-	resolved, err := runner.Resolve(root)
+	return runner.StartContext(context.Background(), tasks...)
+}
+
+// StartContext runs the tasks, canceling ctx cancels them in reverse order
+func (runner Runner) StartContext(ctx context.Context, tasks ...string) error {
+	_, err := runner.ExecuteContext(ctx, tasks...)
+	return err
+}
+
+func (runner Runner) Execute(tasks ...string) (Report, error) {
+	return runner.ExecuteContext(context.Background(), tasks...)
+}
 
+func (runner Runner) ExecuteContext(ctx context.Context, tasks ...string) (Report, error) {
+	run, err := runner.NewRun(tasks...)
 	if err != nil {
-		return err
+		return Report{}, err
 	}
-	resolved = append(resolved, "abort")
-
-	for _, name := range resolved {
-		ctx, cancel := context.WithCancel(context.Background())
-		running[name] = state{cancel, make(chan bool)}
-
-		go func(ctx context.Context, node Node, s state) {
-			defer close(s.Done)
-			for _, dep := range node.Deps {
-				select {
-				case <-ctx.Done(): // if interrupt don't wait any longer
-					return
-				case <-running[dep].Done: // wait for dependencies to finish
-				}
-			}
-			done <- node.Task.Start(ctx) // start job
-		}(ctx, runner[name], running[name])
-	}
-
-	return clean(running, resolved, done)
+	return run.Start(ctx)
 }
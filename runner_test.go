@@ -2,8 +2,10 @@ package antfarm
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"os"
+	"sync"
 	"testing"
 	"time"
 )
@@ -46,14 +48,74 @@ func TestDependencyOrder(t *testing.T) {
 	compare(t, []string(*buffer), []string{"foo", "bar", "world"})
 }
 
+func TestTagged(t *testing.T) {
+	runner := Runner{}.
+		Add(Node{Name: "foo", Task: noop(), Tags: []string{"lint", "ci"}}).
+		Add(Node{Name: "bar", Task: noop(), Tags: []string{"ci"}}).
+		Add(Node{Name: "baz", Task: noop()})
+
+	compare(t, runner.Tagged("ci"), []string{"bar", "foo"})
+	compare(t, runner.Tagged("lint"), []string{"foo"})
+	if names := runner.Tagged("deploy"); names != nil {
+		t.Errorf("no task should have the tag, got: %v", names)
+	}
+	unexpectedErr(t, runner.Start(runner.Tagged("ci")...), nil)
+}
+
 func TestDependencyErr(t *testing.T) {
 	runner := Runner{}.
 		Task("foo", noop(), "bar").
 		Task("bar", noop(), "foo").
 		Task("baz", noop(), "quz")
 
-	unexpectedErr(t, runner.Start("baz"), ErrDepNotFound)
-	unexpectedErr(t, runner.Start("bar"), ErrDepCircular)
+	if err := runner.Start("baz"); !errors.Is(err, ErrDepNotFound) {
+		t.Errorf("unexpected error type, got: %s, expected: %s", err, ErrDepNotFound)
+	}
+	if err := runner.Start("bar"); !errors.Is(err, ErrDepCircular) {
+		t.Errorf("unexpected error type, got: %s, expected: %s", err, ErrDepCircular)
+	}
+}
+
+func TestDependencyNotFoundError(t *testing.T) {
+	_, err := Runner{}.
+		Task("foo", noop(), "bar", "qux").
+		Task("bar", noop(), "baz").
+		Resolve(Node{Deps: []string{"foo", "quz"}})
+
+	errs, ok := err.(DependencyErrors)
+	if !ok {
+		t.Fatalf("unexpected error type, got: %T", err)
+	}
+	if len(errs) != 3 {
+		t.Fatalf("all the missing dependencies should be reported, got: %s", err)
+	}
+	compare(t, errs[0].Missing, []string{"baz"})
+	compare(t, errs[1].Missing, []string{"qux"})
+	compare(t, errs[2].Missing, []string{"quz"})
+	compare(t, []string{errs[0].Task, errs[1].Task, errs[2].Task}, []string{"bar", "foo", ""})
+
+	var notFound *DependencyNotFoundError
+	if !errors.As(err, &notFound) || notFound.Task != "bar" {
+		t.Errorf("errors should unwrap to the first missing dependency, got: %v", notFound)
+	}
+}
+
+func TestCycleError(t *testing.T) {
+	_, err := Runner{}.
+		Task("foo", noop(), "bar").
+		Task("bar", noop(), "baz", "qux").
+		Task("baz", noop()).
+		Task("qux", noop(), "foo").
+		Resolve(Node{Deps: []string{"foo"}})
+
+	var cycle *CycleError
+	if !errors.As(err, &cycle) {
+		t.Fatalf("unexpected error type, got: %T", err)
+	}
+	compare(t, cycle.Path, []string{"foo", "bar", "qux", "foo"})
+	if expected := "circular dependency detected: foo -> bar -> qux -> foo"; err.Error() != expected {
+		t.Errorf("unexpected error message, got: %s, expected: %s", err, expected)
+	}
 }
 
 func TestErrorPropagation(t *testing.T) {
@@ -65,7 +127,229 @@ func TestErrorPropagation(t *testing.T) {
 		Task("bar", Error(ErrBar), "foo").
 		Task("baz", Error(ErrBaz), "bar")
 
-	unexpectedErr(t, runner.Start("baz"), ErrBar)
+	if err := runner.Start("baz"); !errors.Is(err, ErrBar) || errors.Is(err, ErrBaz) {
+		t.Errorf("unexpected error type, got: %s, expected: %s", err, ErrBar)
+	}
+}
+
+func TestErrorCollect(t *testing.T) {
+	ErrFoo := fmt.Errorf("foo")
+	ErrBar := fmt.Errorf("bar")
+	started := make(chan bool)
+
+	err := Runner{}.
+		Task("foo", TaskFunc(func(ctx context.Context) error {
+			close(started)
+			<-ctx.Done()
+			return ErrFoo
+		})).
+		Task("bar", TaskFunc(func(_ context.Context) error {
+			<-started
+			return ErrBar
+		})).
+		Start("foo", "bar")
+
+	var errs TaskErrors
+	if !errors.As(err, &errs) || len(errs) != 2 {
+		t.Fatalf("all the failures should be reported, got: %s", err)
+	}
+	if errs[0].Name != "bar" || errs[0].Err != ErrBar || errs[0].Cancelled {
+		t.Errorf("unexpected first failure, got: %s", errs[0])
+	}
+	if errs[1].Name != "foo" || errs[1].Err != ErrFoo || !errs[1].Cancelled {
+		t.Errorf("unexpected second failure, got: %s", errs[1])
+	}
+	if !errors.Is(err, ErrFoo) || !errors.Is(err, ErrBar) {
+		t.Errorf("errors should unwrap to each cause, got: %s", err)
+	}
+}
+
+func TestKeepGoing(t *testing.T) {
+	ErrFoo := fmt.Errorf("foo")
+	failed := make(chan bool)
+
+	report, err := Runner{KeepGoing: true}.
+		Task("foo", TaskFunc(func(_ context.Context) error {
+			defer close(failed)
+			return ErrFoo
+		})).
+		Task("bar", noop(), "foo").
+		Task("baz", noop(), "bar").
+		Task("qux", TaskFunc(func(ctx context.Context) error {
+			<-failed
+			time.Sleep(10 * time.Millisecond)
+			return ctx.Err() // would be canceled without keep going
+		})).
+		Task("quz", noop(), "qux").
+		Execute("baz", "quz")
+
+	if !errors.Is(err, ErrFoo) {
+		t.Errorf("unexpected error type, got: %s, expected: %s", err, ErrFoo)
+	}
+	if len(report.Failed) != 1 || report.Failed[0].Name != "foo" {
+		t.Errorf("unexpected failed tasks, got: %s", report.Failed)
+	}
+	compare(t, report.Succeeded, []string{"qux", "quz"})
+	compare(t, report.Skipped, []string{"bar", "baz"})
+}
+
+func TestJobs(t *testing.T) {
+	var mutex sync.Mutex
+	var current, max int
+
+	task := func(weight int) Task {
+		return TaskFunc(func(_ context.Context) error {
+			mutex.Lock()
+			if current += weight; current > max {
+				max = current
+			}
+			mutex.Unlock()
+			time.Sleep(10 * time.Millisecond)
+			mutex.Lock()
+			current -= weight
+			mutex.Unlock()
+			return nil
+		})
+	}
+
+	runner := Runner{Jobs: 2}.Add(Node{Name: "heavy", Task: task(2), Weight: 2})
+	targets := []string{"heavy"}
+	for _, name := range []string{"foo", "bar", "baz", "qux"} {
+		runner, targets = runner.Task(name, task(1)), append(targets, name)
+	}
+
+	unexpectedErr(t, runner.Start(targets...), nil)
+	if max != 2 {
+		t.Errorf("unexpected number of slots used at once, got: %d, expected: %d", max, 2)
+	}
+}
+
+func TestResources(t *testing.T) {
+	var mutex sync.Mutex
+	running := map[string]int{}
+	max := map[string]int{}
+
+	task := func(resources ...string) Task {
+		return TaskFunc(func(_ context.Context) error {
+			mutex.Lock()
+			for _, resource := range resources {
+				if running[resource]++; running[resource] > max[resource] {
+					max[resource] = running[resource]
+				}
+			}
+			mutex.Unlock()
+			time.Sleep(10 * time.Millisecond)
+			mutex.Lock()
+			for _, resource := range resources {
+				running[resource]--
+			}
+			mutex.Unlock()
+			return nil
+		})
+	}
+
+	err := Runner{Resources: map[string]int{"port": 2}}.
+		Add(Node{Name: "foo", Task: task("db", "port"), Resources: []string{"port", "db"}}).
+		Add(Node{Name: "bar", Task: task("db"), Resources: []string{"db"}}).
+		Add(Node{Name: "baz", Task: task("port"), Resources: []string{"port"}}).
+		Add(Node{Name: "qux", Task: task("port"), Resources: []string{"port"}}).
+		Add(Node{Name: "quz", Task: task("db", "port"), Resources: []string{"db", "port"}}).
+		Start("foo", "bar", "baz", "qux", "quz")
+
+	unexpectedErr(t, err, nil)
+	if max["db"] != 1 {
+		t.Errorf("undeclared resource should act as a mutex, got: %d tasks at once", max["db"])
+	}
+	if max["port"] != 2 {
+		t.Errorf("unexpected number of tasks sharing the resource, got: %d, expected: %d", max["port"], 2)
+	}
+}
+
+func TestTaskTimeout(t *testing.T) {
+	var canceled bool
+	started := make(chan bool)
+
+	err := Runner{}.
+		Add(Node{Name: "foo", Timeout: 10 * time.Millisecond, Task: TaskFunc(func(ctx context.Context) error {
+			<-started
+			<-ctx.Done()
+			return ctx.Err()
+		})}).
+		Task("bar", TaskFunc(func(ctx context.Context) error {
+			close(started)
+			<-ctx.Done()
+			canceled = true
+			return nil
+		})).
+		Start("foo", "bar")
+
+	var timeout *TimeoutError
+	if !errors.As(err, &timeout) || timeout.Task != "foo" {
+		t.Fatalf("unexpected error type, got: %s", err)
+	}
+	if !errors.Is(err, ErrTimeout) || !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("timeout should match the sentinel and the task error, got: %s", err)
+	}
+	if !canceled {
+		t.Errorf("other tasks should have been canceled")
+	}
+}
+
+func TestRunTimeout(t *testing.T) {
+	err := Runner{Timeout: 10 * time.Millisecond}.
+		Task("foo", TaskFunc(func(ctx context.Context) error {
+			<-ctx.Done()
+			return nil
+		})).
+		Start("foo")
+
+	var timeout *TimeoutError
+	if !errors.As(err, &timeout) || timeout.Task != "" {
+		t.Fatalf("unexpected error type, got: %s", err)
+	}
+	if expected := "run timed out after 10ms"; timeout.Error() != expected {
+		t.Errorf("unexpected error message, got: %s, expected: %s", timeout, expected)
+	}
+}
+
+func TestStartContext(t *testing.T) {
+	type key struct{}
+	var mutex sync.Mutex
+	var order []string
+	started := make(chan string)
+
+	deadline := time.Now().Add(time.Hour)
+	ctx, cancel := context.WithDeadline(context.WithValue(context.Background(), key{}, "value"), deadline)
+	defer cancel()
+
+	task := func(name string) Task {
+		return TaskFunc(func(ctx context.Context) error {
+			if ctx.Value(key{}) != "value" {
+				t.Errorf("context values should reach the task %s", name)
+			}
+			if d, ok := ctx.Deadline(); !ok || !d.Equal(deadline) {
+				t.Errorf("context deadline should reach the task %s, got: %s", name, d)
+			}
+			started <- name
+			<-ctx.Done()
+			mutex.Lock()
+			defer mutex.Unlock()
+			order = append(order, name)
+			return nil
+		})
+	}
+
+	go func() {
+		<-started
+		<-started
+		cancel()
+	}()
+	err := Runner{}.Task("foo", task("foo")).Task("bar", task("bar")).StartContext(ctx, "foo", "bar")
+
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("unexpected error type, got: %s, expected: %s", err, context.Canceled)
+	}
+	compare(t, order, []string{"bar", "foo"})
 }
 
 func TestInterrupt(t *testing.T) {
@@ -90,9 +374,87 @@ func TestInterrupt(t *testing.T) {
 			Start("infinite")
 	}()
 	<-start
-	p, err := os.FindProcess(os.Getpid())
-	unexpectedErr(t, err, nil)
+	p, e := os.FindProcess(os.Getpid())
+	unexpectedErr(t, e, nil)
 	unexpectedErr(t, p.Signal(os.Interrupt), nil)
 	<-stop
-	unexpectedErr(t, err, ErrInterrupt)
+	if !errors.Is(err, ErrInterrupt) {
+		t.Errorf("unexpected error type, got: %s, expected: %s", err, ErrInterrupt)
+	}
+}
+
+func TestSignalGrace(t *testing.T) {
+	started := make(chan bool)
+	go func() {
+		<-started
+		p, err := os.FindProcess(os.Getpid())
+		unexpectedErr(t, err, nil)
+		unexpectedErr(t, p.Signal(os.Interrupt), nil)
+	}()
+
+	err := Runner{Signal: SignalOpts{Grace: time.Minute}}.
+		Task("foo", TaskFunc(func(ctx context.Context) error {
+			close(started)
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-time.After(50 * time.Millisecond):
+				return nil
+			}
+		})).
+		Start("foo")
+	unexpectedErr(t, err, nil)
+}
+
+func TestSignalForce(t *testing.T) {
+	started, release := make(chan bool), make(chan bool)
+	defer close(release)
+	go func() {
+		<-started
+		p, err := os.FindProcess(os.Getpid())
+		unexpectedErr(t, err, nil)
+		unexpectedErr(t, p.Signal(os.Interrupt), nil)
+		time.Sleep(10 * time.Millisecond)
+		unexpectedErr(t, p.Signal(os.Interrupt), nil)
+	}()
+
+	report, err := Runner{Signal: SignalOpts{Grace: time.Minute}}.
+		Task("foo", TaskFunc(func(ctx context.Context) error {
+			close(started)
+			<-release // ignore cancellation
+			return nil
+		})).
+		Execute("foo")
+	if !errors.Is(err, ErrInterrupt) {
+		t.Errorf("unexpected error type, got: %s, expected: %s", err, ErrInterrupt)
+	}
+	compare(t, report.Skipped, []string{"foo"})
+}
+
+func TestCancelledReport(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	report, err := Runner{}.
+		Task("foo", TaskFunc(func(ctx context.Context) error {
+			cancel()
+			<-ctx.Done()
+			return nil // interrupted without an error
+		})).
+		Task("bar", noop(), "foo").
+		ExecuteContext(ctx, "bar")
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("unexpected error type, got: %s, expected: %s", err, context.Canceled)
+	}
+	compare(t, report.Succeeded, nil)
+	compare(t, report.Skipped, []string{"foo", "bar"})
+}
+
+func TestReservedName(t *testing.T) {
+	runner := Runner{}.Task("antfarm:foo", noop()).Task("foo", noop())
+	if err := runner.Start("foo"); !errors.Is(err, ErrReserved) {
+		t.Errorf("unexpected error type, got: %s, expected: %s", err, ErrReserved)
+	}
+	runner = Runner{}.Task("foo", noop(), "antfarm:bar")
+	if err := runner.Start("foo"); !errors.Is(err, ErrReserved) {
+		t.Errorf("unexpected error type, got: %s, expected: %s", err, ErrReserved)
+	}
 }
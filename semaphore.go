@@ -0,0 +1,118 @@
+package antfarm
+
+import (
+	"context"
+	"sync"
+)
+
+type (
+	waiter struct {
+		n     int
+		ready chan bool
+	}
+
+	// semaphore hands out slots in FIFO order, a nil semaphore never blocks
+	semaphore struct {
+		sync.Mutex
+		size, cur int
+		waiters   []*waiter
+	}
+
+	claim struct {
+		*semaphore
+		n int
+	}
+
+	// claims are acquired in order and released in reverse order
+	claims []claim
+)
+
+func newSemaphore(size int) *semaphore {
+	if size < 1 {
+		return nil
+	}
+	return &semaphore{size: size}
+}
+
+// a task heavier than the whole semaphore takes every slot instead of blocking forever
+func (s *semaphore) weight(n int) int {
+	if n > s.size {
+		return s.size
+	}
+	return n
+}
+
+func (s *semaphore) Acquire(ctx context.Context, n int) error {
+	if s == nil {
+		return nil
+	}
+	n = s.weight(n)
+	s.Lock()
+	if s.size-s.cur >= n && len(s.waiters) == 0 {
+		s.cur += n
+		s.Unlock()
+		return nil
+	}
+	w := &waiter{n, make(chan bool)}
+	s.waiters = append(s.waiters, w)
+	s.Unlock()
+
+	select {
+	case <-w.ready:
+		return nil
+	case <-ctx.Done():
+		s.Lock()
+		defer s.Unlock()
+		select {
+		case <-w.ready: // slots were granted meanwhile, give them back
+			s.cur -= n
+		default:
+			for i, elt := range s.waiters {
+				if elt == w {
+					s.waiters = append(s.waiters[:i], s.waiters[i+1:]...)
+					break
+				}
+			}
+		}
+		s.notify()
+		return ctx.Err()
+	}
+}
+
+func (s *semaphore) Release(n int) {
+	if s == nil {
+		return
+	}
+	s.Lock()
+	defer s.Unlock()
+	s.cur -= s.weight(n)
+	s.notify()
+}
+
+func (s *semaphore) notify() {
+	for len(s.waiters) > 0 {
+		w := s.waiters[0]
+		if s.size-s.cur < w.n {
+			return
+		}
+		s.cur += w.n
+		s.waiters = s.waiters[1:]
+		close(w.ready)
+	}
+}
+
+func (c claims) Acquire(ctx context.Context) error {
+	for i, claim := range c {
+		if err := claim.Acquire(ctx, claim.n); err != nil {
+			c[:i].Release()
+			return err
+		}
+	}
+	return nil
+}
+
+func (c claims) Release() {
+	for i := len(c) - 1; i >= 0; i-- {
+		c[i].semaphore.Release(c[i].n)
+	}
+}
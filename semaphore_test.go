@@ -0,0 +1,53 @@
+package antfarm
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestSemaphore(t *testing.T) {
+	sem := newSemaphore(3)
+	unexpectedErr(t, sem.Acquire(context.Background(), 2), nil)
+
+	acquired := make(chan bool)
+	go func() {
+		unexpectedErr(t, sem.Acquire(context.Background(), 2), nil)
+		close(acquired)
+	}()
+
+	select {
+	case <-acquired:
+		t.Fatalf("semaphore should not have enough slots left")
+	case <-time.After(10 * time.Millisecond):
+	}
+	sem.Release(2)
+	<-acquired
+}
+
+func TestSemaphoreOverweight(t *testing.T) {
+	sem := newSemaphore(2)
+	unexpectedErr(t, sem.Acquire(context.Background(), 5), nil)
+	sem.Release(5)
+	if sem.cur != 0 {
+		t.Errorf("all the slots should have been released, got: %d", sem.cur)
+	}
+}
+
+func TestSemaphoreCancel(t *testing.T) {
+	sem := newSemaphore(1)
+	ctx, cancel := context.WithCancel(context.Background())
+	unexpectedErr(t, sem.Acquire(ctx, 1), nil)
+
+	time.AfterFunc(10*time.Millisecond, cancel)
+	unexpectedErr(t, sem.Acquire(ctx, 1), context.Canceled)
+	if len(sem.waiters) != 0 {
+		t.Errorf("canceled waiter should have been removed, got: %d waiters", len(sem.waiters))
+	}
+}
+
+func TestSemaphoreNil(t *testing.T) {
+	sem := newSemaphore(0)
+	unexpectedErr(t, sem.Acquire(context.Background(), 10), nil)
+	sem.Release(10)
+}
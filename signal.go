@@ -0,0 +1,78 @@
+package antfarm
+
+import (
+	"context"
+	"os"
+	"os/signal"
+	"time"
+)
+
+const abortName = "antfarm:abort" // reserved namespace, can not collide with user tasks
+
+type (
+	SignalOpts struct {
+		Signals []os.Signal   // signals aborting the run, defaults to os.Interrupt
+		Grace   time.Duration // time left to the tasks before being canceled once a signal is received
+		Ignore  bool          // do not watch any signal
+	}
+
+	// interruption is closed on the first signal, the second one forces the run to stop
+	interruption struct{ first, second chan bool }
+)
+
+// relay the signals until stop is closed, handler is removed afterwards
+func (opts SignalOpts) notify(stop <-chan bool) interruption {
+	i := interruption{make(chan bool), make(chan bool)}
+	if opts.Ignore {
+		return i
+	}
+
+	signals := opts.Signals
+	if len(signals) == 0 {
+		signals = []os.Signal{os.Interrupt}
+	}
+	ch := make(chan os.Signal, 2)
+	signal.Notify(ch, signals...)
+
+	go func() {
+		defer signal.Stop(ch)
+		for _, c := range []chan bool{i.first, i.second} {
+			select {
+			case <-ch:
+				close(c)
+			case <-stop:
+				return
+			}
+		}
+	}()
+	return i
+}
+
+func (runner Runner) abort(parent context.Context, i interruption) Task {
+	return TaskFunc(func(ctx context.Context) error {
+		var deadline <-chan time.Time
+		if runner.Timeout > 0 {
+			timer := time.NewTimer(runner.Timeout)
+			defer timer.Stop()
+			deadline = timer.C
+		}
+		select {
+		case <-i.first:
+			grace := time.NewTimer(runner.Signal.Grace)
+			defer grace.Stop()
+			select {
+			case <-grace.C:
+			case <-i.second:
+			case <-ctx.Done(): // everything completed during the grace period
+				return nil
+			}
+			return ErrInterrupt
+		case <-deadline:
+			return &TimeoutError{Timeout: runner.Timeout}
+		case <-parent.Done():
+			return parent.Err()
+		case <-ctx.Done():
+		}
+		return nil
+	})
+}
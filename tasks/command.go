@@ -1,11 +1,91 @@
 package tasks
 
 import (
+	"bytes"
 	"context"
+	"fmt"
 	"github.com/ixday/antfarm"
+	"hash/fnv"
+	"io"
+	"os"
 	"os/exec"
+	"sync"
 )
 
+type (
+	OutputOpts struct {
+		Writer    io.Writer     // receives the lines of stdout and stderr, os.Stdout if not set
+		Prefix    string        // written before each line, "[<task name>] " if not set, see antfarm.TaskName
+		NoPrefix  bool          // writes the lines as they are
+		Color     bool          // colours the prefix, the colour is picked from it so a task always keeps its own
+		Buffer    *bytes.Buffer // captures the raw output, also attached to the error of a failure
+		OnFailure bool          // holds the lines back and writes them only if the command fails
+	}
+
+	// CommandError is returned by a failed command, along with its output when captured
+	CommandError struct {
+		Err    error
+		Output []byte
+	}
+
+	// lineWriter prefixes every complete line, partial ones wait for their end or a flush
+	lineWriter struct {
+		out     io.Writer
+		prefix  []byte
+		pending []byte
+	}
+)
+
+var (
+	// lines of commands running in parallel are written one at a time, never interleaved
+	outputMu sync.Mutex
+	colors   = []int{31, 32, 33, 34, 35, 36}
+)
+
+func (e *CommandError) Error() string { return e.Err.Error() }
+func (e *CommandError) Unwrap() error { return e.Err }
+
+func (lw *lineWriter) Write(p []byte) (int, error) {
+	lw.pending = append(lw.pending, p...)
+	i := bytes.LastIndexByte(lw.pending, '\n')
+	if i < 0 {
+		return len(p), nil
+	}
+	err := lw.write(lw.pending[:i+1])
+	lw.pending = append(lw.pending[:0], lw.pending[i+1:]...)
+	return len(p), err
+}
+
+func (lw *lineWriter) write(lines []byte) error {
+	var buf bytes.Buffer
+	for _, line := range bytes.SplitAfter(lines, []byte("\n")) {
+		if len(line) > 0 {
+			buf.Write(lw.prefix)
+			buf.Write(line)
+		}
+	}
+	outputMu.Lock()
+	defer outputMu.Unlock()
+	_, err := lw.out.Write(buf.Bytes())
+	return err
+}
+
+// flush terminates the last line if the command did not
+func (lw *lineWriter) flush() error {
+	if len(lw.pending) == 0 {
+		return nil
+	}
+	err := lw.write(append(lw.pending, '\n'))
+	lw.pending = nil
+	return err
+}
+
+func colorize(prefix string) string {
+	h := fnv.New32a()
+	h.Write([]byte(prefix))
+	return fmt.Sprintf("\x1b[%dm%s\x1b[0m", colors[h.Sum32()%uint32(len(colors))], prefix)
+}
+
 func Command(name string, options ...func(*exec.Cmd)) antfarm.Task {
 	return antfarm.TaskFunc(func(ctx context.Context) error {
 		cmd := exec.CommandContext(ctx, name)
@@ -15,3 +95,58 @@ func Command(name string, options ...func(*exec.Cmd)) antfarm.Task {
 		return cmd.Run()
 	})
 }
+
+// CommandOutput runs a command with its stdout and stderr merged, each line prefixed by the name of the task
+func CommandOutput(name string, output func(*OutputOpts), options ...func(*exec.Cmd)) antfarm.Task {
+	return antfarm.TaskFunc(func(ctx context.Context) error {
+		opts := OutputOpts{Writer: os.Stdout}
+		if output != nil {
+			output(&opts)
+		}
+		if task, ok := antfarm.TaskName(ctx); ok && opts.Prefix == "" {
+			opts.Prefix = "[" + task + "] "
+		}
+		if opts.NoPrefix {
+			opts.Prefix = ""
+		} else if opts.Color && opts.Prefix != "" {
+			opts.Prefix = colorize(opts.Prefix)
+		}
+
+		var held bytes.Buffer
+		lines := &lineWriter{out: opts.Writer, prefix: []byte(opts.Prefix)}
+		if opts.OnFailure {
+			lines.out = &held
+		}
+		var raw bytes.Buffer
+		writer := io.Writer(lines)
+		if opts.Buffer != nil {
+			writer = io.MultiWriter(lines, &raw)
+		}
+
+		cmd := exec.CommandContext(ctx, name)
+		cmd.Stdout, cmd.Stderr = writer, writer // same writer, written by a single goroutine
+		for _, option := range options {
+			option(cmd)
+		}
+		err := cmd.Run()
+		if ferr := lines.flush(); err == nil {
+			err = ferr
+		}
+		if opts.Buffer != nil {
+			opts.Buffer.Write(raw.Bytes())
+		}
+		if err == nil {
+			return nil
+		}
+
+		if opts.OnFailure && held.Len() > 0 {
+			outputMu.Lock()
+			opts.Writer.Write(held.Bytes())
+			outputMu.Unlock()
+		}
+		if opts.Buffer != nil {
+			return &CommandError{err, raw.Bytes()}
+		}
+		return &CommandError{Err: err}
+	})
+}
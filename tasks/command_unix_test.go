@@ -1,9 +1,14 @@
 package tasks
 
 import (
+	"bytes"
 	"context"
+	"errors"
+	"github.com/ixday/antfarm"
 	"os"
 	"os/exec"
+	"sort"
+	"strings"
 	"testing"
 	"time"
 )
@@ -51,3 +56,58 @@ func TestCommandAbort(t *testing.T) {
 		t.Fatalf("unexpected error type, got: %s", err)
 	}
 }
+
+// script runs a shell script writing on both stdout and stderr
+func script(code string) func(*exec.Cmd) {
+	return func(cmd *exec.Cmd) { cmd.Args = append(cmd.Args, "-c", code) }
+}
+
+func TestCommandOutputPrefix(t *testing.T) {
+	out := &bytes.Buffer{}
+	task := CommandOutput("/bin/sh", func(opts *OutputOpts) { opts.Writer = out }, script("echo one; echo two >&2; printf three"))
+	if err := (antfarm.Runner{}).Task("a", task).Task("b", task).Start("a", "b"); err != nil {
+		t.Fatalf("task should not have returned an error, got: %s", err)
+	}
+	lines := strings.SplitAfter(out.String(), "\n")
+	sort.Strings(lines)
+	expected := []string{"", "[a] one\n", "[a] three\n", "[a] two\n", "[b] one\n", "[b] three\n", "[b] two\n"}
+	if strings.Join(lines, "") != strings.Join(expected, "") {
+		t.Errorf("unexpected output, got: %q, wanted: %q", lines, expected)
+	}
+
+	out.Reset()
+	helperMust(t, CommandOutput("/bin/echo", func(opts *OutputOpts) {
+		opts.Writer, opts.Prefix, opts.Color = out, "foo: ", true
+	}, func(cmd *exec.Cmd) { cmd.Args = append(cmd.Args, "bar") }).Start(context.Background()))
+	if got := out.String(); !strings.HasPrefix(got, "\x1b[") || !strings.HasSuffix(got, "foo: \x1b[0mbar\n") {
+		t.Errorf("unexpected coloured output, got: %q", got)
+	}
+}
+
+func TestCommandOutputOnFailure(t *testing.T) {
+	out, buffer := &bytes.Buffer{}, &bytes.Buffer{}
+	quiet := func(code string) antfarm.Task {
+		return CommandOutput("/bin/sh", func(opts *OutputOpts) {
+			opts.Writer, opts.Prefix, opts.Buffer, opts.OnFailure = out, "> ", buffer, true
+		}, script(code))
+	}
+
+	helperMust(t, quiet("echo fine").Start(context.Background()))
+	if out.Len() != 0 || buffer.String() != "fine\n" {
+		t.Errorf("successful command should be quiet, got: %q, captured: %q", out, buffer)
+	}
+
+	buffer.Reset()
+	err := quiet("echo broken >&2; exit 3").Start(context.Background())
+	var cmdErr *CommandError
+	var exitErr *exec.ExitError
+	if !errors.As(err, &cmdErr) || !errors.As(err, &exitErr) || exitErr.ExitCode() != 3 {
+		t.Fatalf("unexpected error type, got: %v", err)
+	}
+	if string(cmdErr.Output) != "broken\n" || buffer.String() != "broken\n" {
+		t.Errorf("output should be attached to the error, got: %q", cmdErr.Output)
+	}
+	if out.String() != "> broken\n" {
+		t.Errorf("failed command should write its output, got: %q", out)
+	}
+}
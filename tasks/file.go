@@ -2,22 +2,54 @@ package tasks
 
 import (
 	"context"
-	"crypto/md5"
-	"encoding/hex"
+	"fmt"
 	"github.com/ixday/antfarm"
 	"io"
+	"io/ioutil"
 	"os"
+	"path/filepath"
 )
 
 type (
-	readerFunc  func(p []byte) (n int, err error)
-	fileCopy    struct{ source, destination string }
-	fileCopyMD5 struct{ fileCopy }
+	CopyOpts struct {
+		PreserveMode  bool // otherwise the mode of the replaced destination, 0644 for a new one
+		PreserveOwner bool // requires the privilege to chown
+		PreserveTimes bool
+	}
+
+	ChecksumOpts struct {
+		Hash  Hash       // SHA256 if not set
+		Cache *HashCache // lives as long as the tasks using it, if not set the tasks of a run share one for the run
+		Copy  CopyOpts   // used by FileCopyChecksum, Sync has preserve options of its own
+	}
+
+	readerFunc func(p []byte) (n int, err error)
+	fileCopy   struct {
+		source, destination string
+		CopyOpts
+	}
+	fileCopyChecksum struct { // replaces the destination, previous content is not kept to be undone
+		source, destination string
+		ChecksumOpts
+	}
 )
 
 func (rf readerFunc) Read(p []byte) (n int, err error) { return rf(p) }
 
-func (fc fileCopy) Abort() { os.Remove(fc.destination) }
+// contextReader fails the reads once the context is done
+func contextReader(ctx context.Context, reader io.Reader) io.Reader {
+	return readerFunc(func(p []byte) (int, error) {
+		select {
+		case <-ctx.Done():
+			return 0, ctx.Err()
+		default:
+			return reader.Read(p)
+		}
+	})
+}
+
+// Abort has nothing to clean, an interrupted copy leaves the destination as it was
+func (fc fileCopy) Abort() {}
 func (fc fileCopy) Expect() (ok bool, err error) {
 	_, err = os.Stat(fc.destination)
 	if os.IsNotExist(err) {
@@ -27,59 +59,124 @@ func (fc fileCopy) Expect() (ok bool, err error) {
 }
 
 func (fc fileCopy) Start(ctx context.Context) error {
-	in, err := os.Open(fc.source)
+	return atomicCopy(ctx, fc.source, fc.destination, fc.CopyOpts)
+}
+
+// Undo removes the destination, it did not exist before the copy
+func (fc fileCopy) Undo() error { return os.Remove(fc.destination) }
+
+// atomicCopy writes a temporary file next to the destination and renames it once synced to disk,
+// the destination is never left half written
+func atomicCopy(ctx context.Context, src, dest string, opts CopyOpts) error {
+	in, err := os.Open(src)
 	if err != nil {
 		return err
 	}
 	defer in.Close()
+	info, err := in.Stat()
+	if err != nil {
+		return err
+	}
 
-	out, err := os.Create(fc.destination)
+	out, err := ioutil.TempFile(filepath.Dir(dest), "."+filepath.Base(dest)+".")
+	if err != nil {
+		return fmt.Errorf("create temporary file for %s: %w", dest, err)
+	}
+	defer os.Remove(out.Name()) // no-op once renamed
+	_, err = io.Copy(out, contextReader(ctx, in))
+	if err == nil {
+		err = out.Sync()
+	}
+	if cerr := out.Close(); err == nil {
+		err = cerr
+	}
 	if err != nil {
 		return err
 	}
-	defer out.Close()
-	_, err = io.Copy(out, readerFunc(func(p []byte) (int, error) {
-		select {
-		case <-ctx.Done():
-			return 0, ctx.Err()
-		default:
-			return in.Read(p)
+
+	mode := os.FileMode(0644)
+	if opts.PreserveMode {
+		mode = info.Mode().Perm()
+	} else if previous, err := os.Stat(dest); err == nil {
+		mode = previous.Mode().Perm()
+	}
+	if err := os.Chmod(out.Name(), mode); err != nil {
+		return err
+	}
+	if opts.PreserveOwner {
+		if err := chown(out.Name(), info); err != nil {
+			return err
 		}
-	}))
-	return err
+	}
+	if opts.PreserveTimes {
+		if err := os.Chtimes(out.Name(), info.ModTime(), info.ModTime()); err != nil {
+			return err
+		}
+	}
+	if err := os.Rename(out.Name(), dest); err != nil {
+		return err
+	}
+	if dir, err := os.Open(filepath.Dir(dest)); err == nil { // persist the rename, best effort
+		dir.Sync()
+		dir.Close()
+	}
+	return nil
 }
 
-func md5HashF(path string) (string, error) {
-	file, err := os.Open(path)
-	if err != nil {
-		return "", err
-	}
-	defer file.Close()
-	return md5Hash(file)
+func (fcc fileCopyChecksum) Abort() {}
+func (fcc fileCopyChecksum) Start(ctx context.Context) error {
+	return atomicCopy(ctx, fcc.source, fcc.destination, fcc.Copy)
 }
 
-func md5Hash(reader io.Reader) (string, error) {
-	hash := md5.New()
-	if _, err := io.Copy(hash, reader); err != nil {
-		return "", err
-	}
+func (fcc fileCopyChecksum) Verify() error { return fcc.VerifyContext(context.Background()) }
 
-	return hex.EncodeToString(hash.Sum(nil)[:16]), nil
+// VerifyContext hashes the destination again, the cache notices it was replaced
+func (fcc fileCopyChecksum) VerifyContext(ctx context.Context) error {
+	differ, err := fcc.ExpectContext(ctx)
+	if err == nil && differ {
+		err = fmt.Errorf("%s hash of %s does not match %s", fcc.Hash.Name, fcc.destination, fcc.source)
+	}
+	return err
 }
 
-func (fcmd5 fileCopyMD5) Expect() (bool, error) {
-	hashSrc, err := md5HashF(fcmd5.source)
+func (fcc fileCopyChecksum) Expect() (bool, error) { return fcc.ExpectContext(context.Background()) }
+
+// ExpectContext hashes the files, large ones can take a while
+func (fcc fileCopyChecksum) ExpectContext(ctx context.Context) (bool, error) {
+	cache := fcc.cache(ctx)
+	hashSrc, err := cache.SumContext(ctx, fcc.Hash, fcc.source)
 	if err != nil {
 		return false, err
 	}
-	hashDest, err := md5HashF(fcmd5.destination)
+	hashDest, err := cache.SumContext(ctx, fcc.Hash, fcc.destination)
 	if err != nil && !os.IsNotExist(err) {
 		return false, err
 	}
 	return hashSrc != hashDest, nil
 }
 
-func FileCopy(src, dest string) antfarm.Task { return antfarm.Provision(fileCopy{src, dest}) }
-func FileCopyMD5(src, dest string) antfarm.Task {
-	return antfarm.Provision(fileCopyMD5{fileCopy{src, dest}})
+// FileCopy copies when the destination does not exist
+func FileCopy(src, dest string, options ...func(*CopyOpts)) antfarm.Task {
+	opts := CopyOpts{}
+	for _, option := range options {
+		option(&opts)
+	}
+	return antfarm.Provision(fileCopy{src, dest, opts})
+}
+
+// FileCopyChecksum copies only when the content of the destination differs from the source
+func FileCopyChecksum(src, dest string, options ...func(*ChecksumOpts)) antfarm.Task {
+	opts := ChecksumOpts{Hash: SHA256}
+	for _, option := range options {
+		option(&opts)
+	}
+	if opts.Hash.New == nil {
+		opts.Hash = SHA256
+	}
+	return antfarm.Provision(fileCopyChecksum{src, dest, opts})
+}
+
+func FileCopyMD5(src, dest string, options ...func(*ChecksumOpts)) antfarm.Task {
+	options = append([]func(*ChecksumOpts){func(opts *ChecksumOpts) { opts.Hash = MD5 }}, options...)
+	return FileCopyChecksum(src, dest, options...)
 }
@@ -4,12 +4,16 @@ package tasks
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"github.com/ixday/antfarm"
 	"io"
 	"io/ioutil"
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
+	"time"
 )
 
 func helperEnv(t *testing.T, fn func(*os.File)) {
@@ -61,7 +65,7 @@ func TestMD5(t *testing.T) {
 	expected := "327b6f07435811239bc47e1544353273"
 
 	helperEnv(t, func(f *os.File) {
-		if hash, err := md5HashF(f.Name()); err != nil {
+		if hash, err := MD5.File(f.Name()); err != nil {
 			t.Fatal(err)
 		} else if hash != expected {
 			t.Errorf("unexpected hash result, want: %s, got: %s", expected, hash)
@@ -73,7 +77,7 @@ func TestMD5NoFile(t *testing.T) {
 	helperEnv(t, func(f *os.File) {
 		helperMust(t, os.Remove(f.Name()))
 		expected := fmt.Sprintf("open %s: no such file or directory", f.Name())
-		if _, err := md5HashF(f.Name()); err.Error() != expected { // this is not robust
+		if _, err := MD5.File(f.Name()); err.Error() != expected { // this is not robust
 			t.Errorf("unexpected error type, want: %s, got: %s", expected, err)
 		}
 	})
@@ -83,7 +87,7 @@ func TestMD5ReaderClosed(t *testing.T) {
 	helperEnv(t, func(f *os.File) {
 		f.Close()
 		expected := fmt.Sprintf("read %s: file already closed", f.Name())
-		if _, err := md5Hash(f); err.Error() != expected { // this is not robust
+		if _, err := MD5.Sum(f); err.Error() != expected { // this is not robust
 			t.Errorf("unexpected error type, want: %s, got: %s", expected, err)
 		}
 	})
@@ -95,12 +99,12 @@ func TestFileCopy(t *testing.T) {
 		if err != nil {
 			t.Errorf("unexpected error from task run, got: %s", err)
 		}
-		hashSrc, err := md5HashF(src.Name())
+		hashSrc, err := MD5.File(src.Name())
 		if err != nil {
 			t.Errorf("unexpected error from hashing src file, got: %s", err)
 		}
 
-		hashDest, err := md5HashF(dest.Name())
+		hashDest, err := MD5.File(dest.Name())
 		if err != nil {
 			t.Errorf("unexpected error from hashing dest file, got: %s", err)
 		}
@@ -123,7 +127,72 @@ func TestFileCopyAbort(t *testing.T) {
 			t.Errorf("unexpected error type, got: %s, want: %s", err, context.Canceled)
 		}
 		if _, err := os.Stat(dest.Name()); !os.IsNotExist(err) {
-			t.Errorf("abort should have removed the dest file, got: %s", err)
+			t.Errorf("aborted copy should not leave a dest file, got: %s", err)
+		}
+	})
+}
+
+func TestFileCopyAbortKeepsDest(t *testing.T) {
+	helperFileCopy(t, func(src, dest *os.File) {
+		helperMust(t, ioutil.WriteFile(dest.Name(), []byte("previous"), 0600))
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		if err := FileCopyChecksum(src.Name(), dest.Name()).Start(ctx); err != context.Canceled {
+			t.Errorf("unexpected error type, got: %v, want: %s", err, context.Canceled)
+		}
+		if b, _ := ioutil.ReadFile(dest.Name()); string(b) != "previous" {
+			t.Errorf("aborted copy should leave the dest file untouched, got: '%s'", b)
+		}
+		files, err := ioutil.ReadDir(filepath.Dir(dest.Name()))
+		helperMust(t, err)
+		if len(files) != 2 {
+			t.Errorf("temporary file should have been removed, got: %d files", len(files))
+		}
+	})
+}
+
+func TestFileCopyUndo(t *testing.T) {
+	helperFileCopy(t, func(src, dest *os.File) {
+		ErrFoo := fmt.Errorf("foo")
+		err := antfarm.Runner{Transactional: true}.
+			Task("copy", FileCopy(src.Name(), dest.Name())).
+			Task("fail", antfarm.TaskFunc(func(_ context.Context) error { return ErrFoo }), "copy").
+			Start("fail")
+		if !errors.Is(err, ErrFoo) {
+			t.Errorf("unexpected error type, got: %v, want: %s", err, ErrFoo)
+		}
+		if _, err := os.Stat(dest.Name()); !os.IsNotExist(err) {
+			t.Errorf("rollback should have removed the dest file, got: %v", err)
+		}
+	})
+}
+
+func TestFileCopyPreserve(t *testing.T) {
+	helperFileCopy(t, func(src, dest *os.File) {
+		earlier := time.Now().Add(-time.Hour).Truncate(time.Second)
+		helperMust(t, os.Chmod(src.Name(), 0751))
+		helperMust(t, os.Chtimes(src.Name(), earlier, earlier))
+		helperMust(t, FileCopy(src.Name(), dest.Name(), func(opts *CopyOpts) {
+			opts.PreserveMode, opts.PreserveOwner, opts.PreserveTimes = true, true, true
+		}).Start(context.Background()))
+		info, err := os.Stat(dest.Name())
+		helperMust(t, err)
+		if info.Mode().Perm() != 0751 || !info.ModTime().Equal(earlier) {
+			t.Errorf("unexpected dest file, got: %s %s, want: %s %s", info.Mode(), info.ModTime(), os.FileMode(0751), earlier)
+		}
+
+		helperMust(t, os.Remove(dest.Name()))
+		helperMust(t, FileCopy(src.Name(), dest.Name()).Start(context.Background()))
+		if info, err := os.Stat(dest.Name()); err != nil || info.Mode().Perm() != 0644 {
+			t.Errorf("unexpected dest file mode, got: %v %v", info, err)
+		}
+
+		helperMust(t, ioutil.WriteFile(dest.Name(), []byte("outdated"), 0600))
+		helperMust(t, FileCopyMD5(src.Name(), dest.Name(), func(opts *ChecksumOpts) {
+			opts.Copy.PreserveMode, opts.Copy.PreserveTimes = true, true
+		}).Start(context.Background()))
+		if info, err := os.Stat(dest.Name()); err != nil || info.Mode().Perm() != 0751 || !info.ModTime().Equal(earlier) {
+			t.Errorf("checksum copy should preserve the mode and times, got: %v %v", info, err)
 		}
 	})
 }
@@ -156,12 +225,12 @@ func TestFileCopyDestExist(t *testing.T) {
 func TestFileCopyDestNotReachable(t *testing.T) {
 	helperEnv(t, func(src *os.File) {
 		helperEnv(t, func(dest *os.File) {
-			expected := fmt.Sprintf("open %s: permission denied", dest.Name())
+			expected := fmt.Sprintf("create temporary file for %s: ", dest.Name())
 			helperMust(t, os.Remove(dest.Name()))
 			helperMust(t, os.Chmod(filepath.Dir(dest.Name()), 0500))
 			err := FileCopy(src.Name(), dest.Name()).Start(context.Background())
-			if err.Error() != expected {
-				t.Errorf("unexpected error type, got: %s, want: %s", err, expected)
+			if !errors.Is(err, os.ErrPermission) || !strings.HasPrefix(err.Error(), expected) {
+				t.Errorf("unexpected error type, got: %v, want: %s...", err, expected)
 			}
 		})
 	})
@@ -171,9 +240,9 @@ func TestFileCopyMD5(t *testing.T) {
 	helperFileCopy(t, func(src *os.File, dest *os.File) {
 		helperMust(t, FileCopyMD5(src.Name(), dest.Name()).Start(context.Background()))
 
-		hashSrc, err := md5HashF(src.Name())
+		hashSrc, err := MD5.File(src.Name())
 		helperMust(t, err)
-		hashDest, err := md5HashF(dest.Name())
+		hashDest, err := MD5.File(dest.Name())
 		helperMust(t, err)
 
 		if hashSrc != hashDest {
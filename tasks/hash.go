@@ -0,0 +1,108 @@
+package tasks
+
+import (
+	"context"
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/hex"
+	"github.com/cespare/xxhash/v2"
+	"github.com/ixday/antfarm"
+	"golang.org/x/crypto/blake2b"
+	"hash"
+	"io"
+	"os"
+	"sync"
+	"time"
+)
+
+type (
+	// Hash is an algorithm used to compare the content of files
+	Hash struct {
+		Name string
+		New  func() hash.Hash
+	}
+
+	// HashCache remembers the hashes of the files, an entry holds while the size, mtime and inode of the file are unchanged
+	HashCache struct {
+		mu      sync.Mutex
+		entries map[cacheKey]cacheEntry
+	}
+
+	cacheKey struct{ hash, path string }
+
+	runCacheKey struct{}
+
+	cacheEntry struct {
+		size  int64
+		mtime time.Time
+		inode uint64
+		sum   string
+	}
+)
+
+var (
+	MD5     = Hash{"md5", md5.New}
+	SHA256  = Hash{"sha256", sha256.New}
+	BLAKE2b = Hash{"blake2b", func() hash.Hash { h, _ := blake2b.New256(nil); return h }} // only fails with a key too long
+	XXHash  = Hash{"xxhash", func() hash.Hash { return xxhash.New() }}
+
+	// Hashes lists the available algorithms by name
+	Hashes = map[string]Hash{MD5.Name: MD5, SHA256.Name: SHA256, BLAKE2b.Name: BLAKE2b, XXHash.Name: XXHash}
+)
+
+func (h Hash) Sum(reader io.Reader) (string, error) {
+	sum := h.New()
+	if _, err := io.Copy(sum, reader); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(sum.Sum(nil)), nil
+}
+
+func (h Hash) File(path string) (string, error) { return h.FileContext(context.Background(), path) }
+
+// FileContext stops reading the file once the context is done
+func (h Hash) FileContext(ctx context.Context, path string) (string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+	return h.Sum(contextReader(ctx, file))
+}
+
+func NewHashCache() *HashCache { return &HashCache{entries: map[cacheKey]cacheEntry{}} }
+
+// cache returns the cache of the options, or the one shared by the tasks of the run, see antfarm.Shared
+func (opts ChecksumOpts) cache(ctx context.Context) *HashCache {
+	if opts.Cache != nil {
+		return opts.Cache
+	}
+	return antfarm.Shared(ctx, runCacheKey{}, func() interface{} { return NewHashCache() }).(*HashCache)
+}
+
+// Sum returns the hash of the file, computed only if the file changed since the last call
+func (c *HashCache) Sum(h Hash, path string) (string, error) {
+	return c.SumContext(context.Background(), h, path)
+}
+
+func (c *HashCache) SumContext(ctx context.Context, h Hash, path string) (string, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return "", err
+	}
+	key, entry := cacheKey{h.Name, path}, cacheEntry{info.Size(), info.ModTime(), inode(info), ""}
+	c.mu.Lock()
+	cached, ok := c.entries[key]
+	c.mu.Unlock()
+	if ok && cached.size == entry.size && cached.mtime.Equal(entry.mtime) && cached.inode == entry.inode {
+		return cached.sum, nil
+	}
+
+	if entry.sum, err = h.FileContext(ctx, path); err != nil {
+		return "", err
+	}
+	c.mu.Lock()
+	c.entries[key] = entry
+	c.mu.Unlock()
+	return entry.sum, nil
+}
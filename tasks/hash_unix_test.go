@@ -0,0 +1,137 @@
+// Interacting with FS here, better scope to OS
+
+package tasks
+
+import (
+	"context"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"github.com/ixday/antfarm"
+	"hash"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestHashes(t *testing.T) {
+	helperEnv(t, func(f *os.File) {
+		for name, expected := range map[string]string{
+			"md5":     "327b6f07435811239bc47e1544353273",
+			"sha256":  "fbc1a9f858ea9e177916964bd88c3d37b91a1e84412765e29950777f265c4b75",
+			"blake2b": "8aced7915f9fc4cafd4a20e6251f600bef4924330d987e3d22130ee201c2fd42",
+			"xxhash":  "03f80edf18cd9da0",
+		} {
+			if sum, err := Hashes[name].File(f.Name()); err != nil {
+				t.Fatal(err)
+			} else if sum != expected {
+				t.Errorf("unexpected %s hash result, want: %s, got: %s", name, expected, sum)
+			}
+		}
+	})
+}
+
+// counting hashes each time the cache needs to compute a sum
+func counting(n *int) Hash {
+	return Hash{"counting", func() hash.Hash { *n++; return sha256.New() }}
+}
+
+func TestHashCache(t *testing.T) {
+	helperEnv(t, func(f *os.File) {
+		var n int
+		cache, h := NewHashCache(), counting(&n)
+		sum := func() string {
+			t.Helper()
+			s, err := cache.Sum(h, f.Name())
+			helperMust(t, err)
+			return s
+		}
+
+		first := sum()
+		if sum(); n != 1 {
+			t.Errorf("unchanged file should be hashed once, got: %d", n)
+		}
+		_, err := f.Write([]byte("!"))
+		helperMust(t, err)
+		if sum() == first || n != 2 {
+			t.Errorf("modified file should be hashed again, got: %d", n)
+		}
+
+		later := time.Now().Add(time.Hour)
+		helperMust(t, os.Chtimes(f.Name(), later, later))
+		if sum(); n != 3 {
+			t.Errorf("touched file should be hashed again, got: %d", n)
+		}
+		if _, err := cache.Sum(h, f.Name()+".missing"); !os.IsNotExist(err) {
+			t.Errorf("unexpected error type, got: %s", err)
+		}
+
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		helperMust(t, os.Chtimes(f.Name(), time.Now(), time.Now()))
+		if _, err := cache.SumContext(ctx, h, f.Name()); err != context.Canceled {
+			t.Errorf("unexpected error type, got: %v, want: %s", err, context.Canceled)
+		}
+	})
+}
+
+func TestHashCacheRun(t *testing.T) {
+	helperFileCopy(t, func(src, dest *os.File) {
+		var n int
+		h := counting(&n)
+		checksum := func(dest string) antfarm.Task {
+			return FileCopyChecksum(src.Name(), dest, func(opts *ChecksumOpts) { opts.Hash = h })
+		}
+		runner := antfarm.Runner{}.
+			Task("a", checksum(dest.Name())).
+			Task("b", checksum(dest.Name()+".b"), "a")
+		helperMust(t, runner.Start("b"))
+		if n != 3 { // the source once, each destination after its copy
+			t.Errorf("tasks of a run should share a cache, got: %d hashes", n)
+		}
+		helperMust(t, runner.Start("b"))
+		if n != 6 {
+			t.Errorf("a new run should start with a new cache, got: %d hashes", n)
+		}
+	})
+}
+
+func TestFileCopyChecksum(t *testing.T) {
+	helperFileCopy(t, func(src, dest *os.File) {
+		var n int
+		cache, h := NewHashCache(), counting(&n)
+		task := FileCopyChecksum(src.Name(), dest.Name(), func(opts *ChecksumOpts) { opts.Hash, opts.Cache = h, cache })
+		for i := 0; i < 3; i++ {
+			helperMust(t, task.Start(context.Background()))
+		}
+		if n != 2 {
+			t.Errorf("files should be hashed once each, got: %d", n)
+		}
+
+		helperMust(t, os.Truncate(dest.Name(), 0))
+		helperMust(t, task.Start(context.Background()))
+		hashSrc, err := SHA256.File(src.Name())
+		helperMust(t, err)
+		hashDest, err := SHA256.File(dest.Name())
+		helperMust(t, err)
+		if n != 4 || hashSrc != hashDest {
+			t.Errorf("modified destination should be hashed, copied and verified again, got: %d", n)
+		}
+	})
+}
+
+func TestFileCopyChecksumVerify(t *testing.T) {
+	helperFileCopy(t, func(src, dest *os.File) {
+		var n int
+		salted := Hash{"salted", func() hash.Hash { // every file hashes differently
+			n++
+			h := sha256.New()
+			fmt.Fprint(h, n)
+			return h
+		}}
+		err := FileCopyChecksum(src.Name(), dest.Name(), func(opts *ChecksumOpts) { opts.Hash = salted }).Start(context.Background())
+		if !errors.Is(err, antfarm.ErrVerify) {
+			t.Errorf("unexpected error type, got: %v, want: %s", err, antfarm.ErrVerify)
+		}
+	})
+}
@@ -0,0 +1,12 @@
+//go:build !aix && !darwin && !dragonfly && !freebsd && !linux && !netbsd && !openbsd && !solaris
+// +build !aix,!darwin,!dragonfly,!freebsd,!linux,!netbsd,!openbsd,!solaris
+
+package tasks
+
+import "os"
+
+// inode is not exposed, the cache relies on the size and mtime only
+func inode(_ os.FileInfo) uint64 { return 0 }
+
+// chown is not supported, the files belong to the current user
+func chown(_ string, _ os.FileInfo) error { return nil }
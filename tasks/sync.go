@@ -0,0 +1,343 @@
+package tasks
+
+import (
+	"context"
+	"github.com/ixday/antfarm"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const (
+	created changeKind = iota
+	updated
+	deleted
+)
+
+type (
+	SyncOpts struct {
+		Include []string // globs of the files to sync, every file if empty
+		Exclude []string // globs of the files and directories left alone, on both sides
+		Delete  bool     // remove the destination files missing from the source
+
+		// compare the content of the files rather than their size and mtime, see ChecksumOpts
+		Checksum bool
+		ChecksumOpts
+
+		// as rsync -a does, without them files are always considered different when comparing by size and mtime
+		PreserveModes bool
+		PreserveTimes bool
+		PreserveLinks bool // copy the symlinks as such rather than the files they point to
+
+		DryRun bool             // compute the changes without applying them
+		Report func(SyncReport) // receives the changes once applied, or computed when running dry
+	}
+
+	// SyncReport lists the paths relative to the synced directories
+	SyncReport struct {
+		Created []string
+		Updated []string
+		Deleted []string
+	}
+
+	changeKind int
+
+	change struct {
+		kind changeKind
+		path string      // relative
+		info os.FileInfo // of the source, nil when deleted
+	}
+
+	dirSync struct {
+		source, destination string
+		SyncOpts
+	}
+)
+
+// Sync mirrors the source directory into the destination, the expectation tells if they differ
+func Sync(src, dest string, options ...func(*SyncOpts)) antfarm.Task {
+	opts := SyncOpts{ChecksumOpts: ChecksumOpts{Hash: SHA256}}
+	for _, option := range options {
+		option(&opts)
+	}
+	if opts.Hash.New == nil {
+		opts.Hash = SHA256
+	}
+	return antfarm.Provision(dirSync{src, dest, opts})
+}
+
+// match tells if the relative path matches one of the globs, a glob without separator matches the base name
+func match(patterns []string, path string) bool {
+	for _, pattern := range patterns {
+		name := path
+		if !strings.ContainsRune(pattern, filepath.Separator) {
+			name = filepath.Base(path)
+		}
+		if ok, _ := filepath.Match(pattern, name); ok {
+			return true
+		}
+	}
+	return false
+}
+
+func isLink(path string) bool {
+	info, err := os.Lstat(path)
+	return err == nil && info.Mode()&os.ModeSymlink != 0
+}
+
+func (s dirSync) stat(path string) (os.FileInfo, error) {
+	if s.PreserveLinks {
+		return os.Lstat(path)
+	}
+	return os.Stat(path)
+}
+
+// differ compares an existing destination with its source
+func (s dirSync) differ(ctx context.Context, rel string, src, dest os.FileInfo) (bool, error) {
+	switch {
+	case src.Mode().Type() != dest.Mode().Type():
+		return true, nil
+	case s.PreserveModes && src.Mode().Perm() != dest.Mode().Perm():
+		return true, nil
+	case src.Mode()&os.ModeSymlink != 0:
+		from, err := os.Readlink(filepath.Join(s.source, rel))
+		if err != nil {
+			return false, err
+		}
+		to, err := os.Readlink(filepath.Join(s.destination, rel))
+		return from != to, err
+	case src.IsDir():
+		return false, nil
+	case !s.Checksum:
+		return src.Size() != dest.Size() || !src.ModTime().Equal(dest.ModTime()), nil
+	}
+	cache := s.cache(ctx)
+	hashSrc, err := cache.SumContext(ctx, s.Hash, filepath.Join(s.source, rel))
+	if err != nil {
+		return false, err
+	}
+	hashDest, err := cache.SumContext(ctx, s.Hash, filepath.Join(s.destination, rel))
+	return hashSrc != hashDest, err
+}
+
+// diff walks both trees and lists what has to change in the destination, parents come before their children
+func (s dirSync) diff(ctx context.Context) ([]change, error) {
+	var changes []change
+	seen := map[string]os.FileInfo{} // synced entries of the source
+	err := filepath.Walk(s.source, func(path string, _ os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		} else if err := ctx.Err(); err != nil {
+			return err
+		}
+		rel, _ := filepath.Rel(s.source, path)
+		info, err := s.stat(path)
+		switch {
+		case err != nil:
+			return err
+		case rel == "." || info.IsDir() && path != s.source && isLink(path): // linked directories are not followed
+			return nil
+		case match(s.Exclude, rel):
+			if info.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		case !info.IsDir() && len(s.Include) > 0 && !match(s.Include, rel):
+			return nil
+		}
+
+		seen[rel] = info
+		dest, err := os.Lstat(filepath.Join(s.destination, rel))
+		if os.IsNotExist(err) {
+			changes = append(changes, change{created, rel, info})
+			return nil
+		} else if err != nil {
+			return err
+		}
+		if differ, err := s.differ(ctx, rel, info, dest); err != nil || !differ {
+			return err
+		}
+		changes = append(changes, change{updated, rel, info})
+		return nil
+	})
+	if err != nil || !s.Delete {
+		return changes, err
+	}
+
+	if _, err := os.Lstat(s.destination); os.IsNotExist(err) {
+		return changes, nil
+	}
+	deletions, _, err := s.extraneous(ctx, ".", seen)
+	return append(changes, deletions...), err
+}
+
+// extraneous lists the deletions under a directory of the destination, protected tells if something is kept in it.
+// An extraneous directory is deleted at once when nothing is protected inside, its content one by one otherwise.
+func (s dirSync) extraneous(ctx context.Context, dir string, seen map[string]os.FileInfo) ([]change, bool, error) {
+	entries, err := ioutil.ReadDir(filepath.Join(s.destination, dir))
+	if err != nil {
+		return nil, true, err
+	}
+	var changes []change
+	var protected bool
+	for _, entry := range entries {
+		if err := ctx.Err(); err != nil {
+			return nil, true, err
+		}
+		rel := filepath.Join(dir, entry.Name())
+		src, synced := seen[rel]
+		switch {
+		case match(s.Exclude, rel):
+			protected = true
+		case synced:
+			protected = true
+			if !src.IsDir() || !entry.IsDir() { // replaced as a whole when the type changed
+				continue
+			}
+			deletions, _, err := s.extraneous(ctx, rel, seen)
+			if err != nil {
+				return nil, true, err
+			}
+			changes = append(changes, deletions...)
+		case entry.IsDir():
+			deletions, kept, err := s.extraneous(ctx, rel, seen)
+			if err != nil {
+				return nil, true, err
+			}
+			if protected = protected || kept; kept {
+				changes = append(changes, deletions...)
+			} else {
+				changes = append(changes, change{deleted, rel, nil})
+			}
+		case len(s.Include) == 0 || match(s.Include, rel):
+			changes = append(changes, change{deleted, rel, nil})
+		default: // not included, left alone as at the top level
+			protected = true
+		}
+	}
+	return changes, protected, nil
+}
+
+func (s dirSync) Expect() (bool, error) { return s.ExpectContext(context.Background()) }
+
+func (s dirSync) ExpectContext(ctx context.Context) (bool, error) {
+	changes, err := s.diff(ctx)
+	return len(changes) > 0, err
+}
+
+func (s dirSync) apply(ctx context.Context, c change) error {
+	dest := filepath.Join(s.destination, c.path)
+	if c.kind == deleted {
+		return os.RemoveAll(dest)
+	}
+	if info, err := os.Lstat(dest); err == nil && info.Mode().Type() != c.info.Mode().Type() {
+		if err := os.RemoveAll(dest); err != nil { // a file became a directory or the other way around
+			return err
+		}
+	}
+
+	switch {
+	case c.info.IsDir():
+		mode := os.FileMode(0755)
+		if s.PreserveModes {
+			mode = c.info.Mode().Perm() | 0700 // writable until its children are synced, see Start
+		}
+		if err := os.Mkdir(dest, mode); err != nil && !os.IsExist(err) {
+			return err
+		}
+		return os.Chmod(dest, mode)
+	case c.info.Mode()&os.ModeSymlink != 0:
+		target, err := os.Readlink(filepath.Join(s.source, c.path))
+		if err != nil {
+			return err
+		}
+		os.Remove(dest)
+		return os.Symlink(target, dest)
+	}
+	return atomicCopy(ctx, filepath.Join(s.source, c.path), dest, CopyOpts{PreserveMode: s.PreserveModes})
+}
+
+// unlock makes an existing directory of the destination writable, its mode is kept to be restored
+func (s dirSync) unlock(dir string, locked map[string]os.FileMode) error {
+	if _, ok := locked[dir]; ok {
+		return nil
+	}
+	info, err := os.Lstat(dir)
+	if err != nil || !info.IsDir() || info.Mode().Perm()&0200 != 0 {
+		return nil // created writable by the changes before it
+	}
+	locked[dir] = info.Mode().Perm()
+	return os.Chmod(dir, info.Mode().Perm()|0200)
+}
+
+func (s dirSync) Start(ctx context.Context) error {
+	changes, err := s.diff(ctx)
+	if err != nil {
+		return err
+	}
+	var report SyncReport
+	defer func() {
+		if s.Report != nil {
+			s.Report(report)
+		}
+	}()
+	if !s.DryRun {
+		if err := os.MkdirAll(s.destination, 0755); err != nil {
+			return err
+		}
+	}
+
+	locked := map[string]os.FileMode{} // read-only directories made writable for the changes, restored once done
+	defer func() {
+		for path, mode := range locked {
+			os.Chmod(path, mode)
+		}
+	}()
+	for _, c := range changes {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if !s.DryRun {
+			if err := s.unlock(filepath.Dir(filepath.Join(s.destination, c.path)), locked); err != nil {
+				return err
+			}
+			if err := s.apply(ctx, c); err != nil {
+				return err
+			}
+		}
+		switch c.kind {
+		case created:
+			report.Created = append(report.Created, c.path)
+		case updated:
+			report.Updated = append(report.Updated, c.path)
+		case deleted:
+			report.Deleted = append(report.Deleted, c.path)
+		}
+	}
+	if s.DryRun || !s.PreserveTimes && !s.PreserveModes {
+		return nil
+	}
+	for i := len(changes) - 1; i >= 0; i-- { // children first, writing into a directory changes its mtime
+		c := changes[i]
+		if c.kind == deleted || c.info.Mode()&os.ModeSymlink != 0 {
+			continue
+		}
+		path := filepath.Join(s.destination, c.path)
+		if s.PreserveModes && c.info.IsDir() {
+			if err := os.Chmod(path, c.info.Mode().Perm()); err != nil {
+				return err
+			}
+			delete(locked, path)
+		}
+		if s.PreserveTimes {
+			if err := os.Chtimes(path, c.info.ModTime(), c.info.ModTime()); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// Abort leaves the destination as is, files are replaced at once so none is half written
+func (s dirSync) Abort() {}
@@ -0,0 +1,208 @@
+// Interacting with FS here, better scope to OS
+
+package tasks
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// helperTree writes the files under root, creating their parent directories
+func helperTree(t *testing.T, root string, files map[string]string) {
+	t.Helper()
+	for name, content := range files {
+		path := filepath.Join(root, name)
+		helperMust(t, os.MkdirAll(filepath.Dir(path), 0755))
+		helperMust(t, ioutil.WriteFile(path, []byte(content), 0644))
+	}
+}
+
+func helperSync(t *testing.T, fn func(src, dest string)) {
+	t.Helper()
+	dir, err := ioutil.TempDir("", "")
+	helperMust(t, err)
+	defer func() { helperMust(t, os.RemoveAll(dir)) }()
+	src, dest := filepath.Join(dir, "src"), filepath.Join(dir, "dest")
+	helperTree(t, src, map[string]string{"a.txt": "a", "b.log": "b", "sub/c.txt": "c", "tmp/d.txt": "d"})
+	fn(src, dest)
+}
+
+func helperSyncRun(t *testing.T, src, dest string, options ...func(*SyncOpts)) SyncReport {
+	t.Helper()
+	var report SyncReport
+	options = append(options, func(opts *SyncOpts) { opts.Report = func(r SyncReport) { report = r } })
+	helperMust(t, Sync(src, dest, options...).Start(context.Background()))
+	return report
+}
+
+func helperReport(t *testing.T, got, expected SyncReport) {
+	t.Helper()
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("unexpected report, got: %+v, expected: %+v", got, expected)
+	}
+}
+
+func TestSync(t *testing.T) {
+	helperSync(t, func(src, dest string) {
+		preserve := func(opts *SyncOpts) { opts.PreserveTimes, opts.PreserveModes = true, true }
+		helperReport(t, helperSyncRun(t, src, dest, preserve), SyncReport{
+			Created: []string{"a.txt", "b.log", "sub", "sub/c.txt", "tmp", "tmp/d.txt"},
+		})
+		helperReport(t, helperSyncRun(t, src, dest, preserve), SyncReport{}) // nothing changed
+
+		helperTree(t, src, map[string]string{"a.txt": "aa"})
+		helperMust(t, os.Remove(filepath.Join(src, "b.log")))
+		helperTree(t, dest, map[string]string{"extra/e.txt": "e"})
+		helperReport(t, helperSyncRun(t, src, dest, preserve, func(opts *SyncOpts) { opts.Delete = true }), SyncReport{
+			Updated: []string{"a.txt"},
+			Deleted: []string{"b.log", "extra"},
+		})
+		if b, _ := ioutil.ReadFile(filepath.Join(dest, "a.txt")); string(b) != "aa" {
+			t.Errorf("unexpected content, got: %q", b)
+		}
+		if _, err := os.Stat(filepath.Join(dest, "extra")); !os.IsNotExist(err) {
+			t.Errorf("extraneous directory should have been deleted, got: %v", err)
+		}
+		info, err := os.Stat(filepath.Join(dest, "sub"))
+		helperMust(t, err)
+		srcInfo, err := os.Stat(filepath.Join(src, "sub"))
+		helperMust(t, err)
+		if !info.ModTime().Equal(srcInfo.ModTime()) {
+			t.Errorf("directory times should be preserved, got: %s, expected: %s", info.ModTime(), srcInfo.ModTime())
+		}
+	})
+}
+
+func TestSyncReadOnly(t *testing.T) {
+	helperSync(t, func(src, dest string) {
+		helperTree(t, src, map[string]string{"ro/e.txt": "e"})
+		helperMust(t, os.Chmod(filepath.Join(src, "ro"), 0555))
+		defer func() { // to be removable when not running as root
+			os.Chmod(filepath.Join(src, "ro"), 0755)
+			os.Chmod(filepath.Join(dest, "ro"), 0755)
+		}()
+		preserve := func(opts *SyncOpts) { opts.PreserveModes, opts.PreserveTimes = true, true }
+		expect := func(content string) {
+			t.Helper()
+			info, err := os.Stat(filepath.Join(dest, "ro"))
+			helperMust(t, err)
+			if info.Mode().Perm() != 0555 {
+				t.Errorf("directory mode should be preserved, got: %s", info.Mode())
+			}
+			if b, _ := ioutil.ReadFile(filepath.Join(dest, "ro", "e.txt")); string(b) != content {
+				t.Errorf("unexpected content, got: %q, expected: %q", b, content)
+			}
+		}
+		helperSyncRun(t, src, dest, preserve)
+		expect("e")
+
+		helperMust(t, os.Chmod(filepath.Join(src, "ro"), 0755))
+		helperTree(t, src, map[string]string{"ro/e.txt": "ee", "ro/f.txt": "f"})
+		helperMust(t, os.Chmod(filepath.Join(src, "ro"), 0555))
+		helperReport(t, helperSyncRun(t, src, dest, preserve), SyncReport{
+			Created: []string{"ro/f.txt"},
+			Updated: []string{"ro/e.txt"},
+		})
+		expect("ee")
+	})
+}
+
+func TestSyncFilters(t *testing.T) {
+	helperSync(t, func(src, dest string) {
+		helperTree(t, dest, map[string]string{
+			"tmp/keep.txt": "keep", "old.txt": "old", "old.bin": "old",
+			"docs/README": "keep", "docs/old.txt": "old", "gone/old.txt": "old",
+		})
+		helperReport(t, helperSyncRun(t, src, dest, func(opts *SyncOpts) {
+			opts.Include, opts.Exclude, opts.Delete = []string{"*.txt"}, []string{"tmp"}, true
+		}), SyncReport{
+			Created: []string{"a.txt", "sub", "sub/c.txt"},
+			// not included files are kept at any depth, along with their directory, tmp is excluded on both sides
+			Deleted: []string{"docs/old.txt", "gone", "old.txt"},
+		})
+		for _, name := range []string{"tmp/keep.txt", "old.bin", "docs/README"} {
+			if _, err := os.Stat(filepath.Join(dest, name)); err != nil {
+				t.Errorf("%s should have been left alone, got: %s", name, err)
+			}
+		}
+	})
+}
+
+func TestSyncCompare(t *testing.T) {
+	helperSync(t, func(src, dest string) {
+		earlier := time.Now().Add(-time.Hour) // the copies must not share the mtime of their source
+		for _, name := range []string{"a.txt", "b.log", "sub/c.txt", "tmp/d.txt"} {
+			helperMust(t, os.Chtimes(filepath.Join(src, name), earlier, earlier))
+		}
+		helperSyncRun(t, src, dest)
+		// without preserving the times, size and mtime always differ
+		if report := helperSyncRun(t, src, dest); len(report.Updated) != 4 {
+			t.Errorf("unexpected report, got: %+v", report)
+		}
+		checksum := func(opts *SyncOpts) { opts.Checksum, opts.Hash = true, XXHash }
+		helperReport(t, helperSyncRun(t, src, dest, checksum), SyncReport{})
+
+		later := time.Now().Add(time.Hour)
+		helperMust(t, os.Chtimes(filepath.Join(dest, "a.txt"), later, later))
+		helperTree(t, dest, map[string]string{"sub/c.txt": "C"})
+		helperReport(t, helperSyncRun(t, src, dest, checksum), SyncReport{Updated: []string{"sub/c.txt"}})
+	})
+}
+
+func TestSyncLinks(t *testing.T) {
+	helperSync(t, func(src, dest string) {
+		helperMust(t, os.Symlink("a.txt", filepath.Join(src, "link")))
+		links := func(opts *SyncOpts) { opts.PreserveLinks = true }
+		helperSyncRun(t, src, dest, links)
+		if target, err := os.Readlink(filepath.Join(dest, "link")); err != nil || target != "a.txt" {
+			t.Errorf("symlink should be preserved, got: %s %v", target, err)
+		}
+		helperReport(t, helperSyncRun(t, src, dest, links, func(opts *SyncOpts) { opts.Checksum = true }), SyncReport{})
+
+		helperMust(t, os.RemoveAll(dest))
+		helperSyncRun(t, src, dest)
+		if info, err := os.Lstat(filepath.Join(dest, "link")); err != nil || !info.Mode().IsRegular() {
+			t.Errorf("symlink should be followed, got: %v %v", info, err)
+		}
+	})
+}
+
+func TestSyncExpect(t *testing.T) {
+	helperSync(t, func(src, dest string) {
+		task := Sync(src, dest, func(opts *SyncOpts) { opts.Checksum = true }).(interface{ Expect() (bool, error) })
+		if ok, err := task.Expect(); err != nil || !ok {
+			t.Errorf("expectation should not be met, got: %t %v", ok, err)
+		}
+		helperSyncRun(t, src, dest)
+		if ok, err := task.Expect(); err != nil || ok {
+			t.Errorf("expectation should be met, got: %t %v", ok, err)
+		}
+	})
+}
+
+func TestSyncDryRun(t *testing.T) {
+	helperSync(t, func(src, dest string) {
+		report := helperSyncRun(t, src, dest, func(opts *SyncOpts) { opts.DryRun = true })
+		if len(report.Created) != 6 {
+			t.Errorf("unexpected report, got: %+v", report)
+		}
+		if _, err := os.Stat(dest); !os.IsNotExist(err) {
+			t.Errorf("dry run should not write anything, got: %v", err)
+		}
+	})
+}
+
+func TestSyncAbort(t *testing.T) {
+	helperSync(t, func(src, dest string) {
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		if err := Sync(src, dest).Start(ctx); err != context.Canceled {
+			t.Errorf("unexpected error type, got: %v, want: %s", err, context.Canceled)
+		}
+	})
+}
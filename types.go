@@ -2,32 +2,112 @@ package antfarm
 
 import (
 	"context"
+	"fmt"
+	"time"
 )
 
+var ErrVerify = fmt.Errorf("verification failed")
+
 type (
 	Task interface {
 		Start(context.Context) error
 	}
-	Provisioner interface {
+	Expecter interface {
 		Expect() (bool, error)
+	}
+	Provisioner interface {
+		Expecter
 		Task
 		Abort()
 	}
+	// ExpecterContext is preferred to Expect by Provision, the context is the one of the run
+	ExpecterContext interface {
+		ExpectContext(context.Context) (bool, error)
+	}
+	// AborterContext is preferred to Abort by Provision. The context keeps the values of the run
+	// but not its cancellation, which is often why the provisioner is aborted, it expires after ProvisionOpts.AbortTimeout.
+	AborterContext interface {
+		AbortContext(context.Context)
+	}
+	// Verifier is implemented by the provisioners able to confirm their target state once started
+	Verifier interface {
+		Verify() error
+	}
+	// VerifierContext is preferred to Verify by Provision, the context is the one of the run
+	VerifierContext interface {
+		VerifyContext(context.Context) error
+	}
 	TaskFunc func(context.Context) error
+
+	ProvisionOpts struct {
+		AbortTimeout time.Duration // bounds the context given to AbortContext, defaults to 30s
+	}
+
+	// provisioned exposes the expectation of its provisioner, see Runner.Plan
+	provisioned struct {
+		provisioner Provisioner
+		ProvisionOpts
+	}
 )
 
 func (tf TaskFunc) Start(ctx context.Context) error { return tf(ctx) }
 
-func Provision(provisioner Provisioner) Task {
-	return TaskFunc(func(ctx context.Context) error {
-		if ok, err := provisioner.Expect(); err != nil || !ok {
-			return err
-		}
+func (p provisioned) Expect() (bool, error) { return p.ExpectContext(context.Background()) }
+
+func (p provisioned) ExpectContext(ctx context.Context) (bool, error) {
+	if expecter, ok := p.provisioner.(ExpecterContext); ok {
+		return expecter.ExpectContext(ctx)
+	}
+	return p.provisioner.Expect()
+}
+
+func (p provisioned) abort(ctx context.Context) {
+	if aborter, ok := p.provisioner.(AborterContext); ok {
+		ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), p.AbortTimeout)
+		defer cancel()
+		aborter.AbortContext(ctx)
+		return
+	}
+	p.provisioner.Abort()
+}
 
-		if err := provisioner.Start(ctx); err != nil {
-			provisioner.Abort()
-			return err
+// verify confirms the target state when the provisioner is able to
+func (p provisioned) verify(ctx context.Context) error {
+	switch verifier := p.provisioner.(type) {
+	case VerifierContext:
+		return verifier.VerifyContext(ctx)
+	case Verifier:
+		return verifier.Verify()
+	}
+	return nil
+}
+
+func (p provisioned) Start(ctx context.Context) error {
+	if ok, err := p.ExpectContext(ctx); err != nil || !ok {
+		if err == nil {
+			emit(ctx, Satisfied)
 		}
-		return nil
-	})
+		return err
+	}
+
+	if err := p.provisioner.Start(ctx); err != nil {
+		p.abort(ctx)
+		return err
+	}
+	if err := p.verify(ctx); err != nil {
+		p.abort(ctx)
+		return fmt.Errorf("%w: %w", ErrVerify, err)
+	}
+	if undoer, ok := p.provisioner.(Undoer); ok {
+		record(ctx, undoer)
+	}
+	return nil
+}
+
+func Provision(provisioner Provisioner, options ...func(*ProvisionOpts)) Task {
+	opts := ProvisionOpts{AbortTimeout: 30 * time.Second}
+	for _, option := range options {
+		option(&opts)
+	}
+	return provisioned{provisioner, opts}
 }
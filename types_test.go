@@ -4,6 +4,7 @@ import (
 	"context"
 	"errors"
 	"testing"
+	"time"
 )
 
 type MockProvisioner struct {
@@ -80,3 +81,97 @@ func TestProvisionerAbortTriggered(t *testing.T) {
 	runErr := errors.New("error during running phase")
 	NewMockProvisioner(func(mp *MockProvisioner) { mp.StartErr = runErr }).Run(t, true, true, true, runErr)
 }
+
+type verifiedProvisioner struct {
+	*MockProvisioner
+	VerifyErr error
+}
+
+func (vp verifiedProvisioner) Verify() error { return vp.VerifyErr }
+
+func TestProvisionerVerify(t *testing.T) {
+	mp := NewMockProvisioner()
+	if err := Provision(verifiedProvisioner{mp, nil}).Start(context.Background()); err != nil || mp.abortCalled {
+		t.Errorf("verified provisioner should not be aborted, got: %s", err)
+	}
+
+	verifyErr := errors.New("error during verify phase")
+	mp = NewMockProvisioner()
+	err := Provision(verifiedProvisioner{mp, verifyErr}).Start(context.Background())
+	if !errors.Is(err, ErrVerify) || !errors.Is(err, verifyErr) {
+		t.Errorf("unexpected error type, got: %s, expected: %s", err, verifyErr)
+	}
+	if !mp.abortCalled {
+		t.Errorf("abort function should have been called")
+	}
+}
+
+type ctxKey struct{}
+
+// contextProvisioner records the contexts it was given, the legacy methods must not be called
+type contextProvisioner struct {
+	*MockProvisioner
+	expectCtx, abortCtx context.Context
+	abortErr            error // of the context while aborting
+}
+
+func (cp *contextProvisioner) Expect() (bool, error) { panic("ExpectContext should be preferred") }
+func (cp *contextProvisioner) Abort()                { panic("AbortContext should be preferred") }
+
+func (cp *contextProvisioner) ExpectContext(ctx context.Context) (bool, error) {
+	cp.expectCtx = ctx
+	return cp.ExpectOk, cp.ExpectErr
+}
+
+func (cp *contextProvisioner) AbortContext(ctx context.Context) {
+	cp.abortCtx, cp.abortErr = ctx, ctx.Err()
+}
+
+func TestProvisionerContext(t *testing.T) {
+	runErr := errors.New("error during running phase")
+	cp := &contextProvisioner{MockProvisioner: NewMockProvisioner(func(mp *MockProvisioner) { mp.StartErr = runErr })}
+	ctx, cancel := context.WithCancel(context.WithValue(context.Background(), ctxKey{}, "run"))
+	cancel() // as when a sibling failed or the run was interrupted
+	if err := Provision(cp).Start(ctx); err != runErr {
+		t.Errorf("should return the expected error, expected: %s, got: %s", runErr, err)
+	}
+	if cp.expectCtx != ctx {
+		t.Errorf("context of the run should be passed through, got: %v", cp.expectCtx)
+	}
+	if _, ok := cp.abortCtx.Deadline(); !ok || cp.abortErr != nil || cp.abortCtx.Value(ctxKey{}) != "run" {
+		t.Errorf("abort should get the values of the run, bounded but not canceled, got: %v %v", cp.abortCtx, cp.abortErr)
+	}
+	Provision(cp, func(opts *ProvisionOpts) { opts.AbortTimeout = time.Hour }).Start(ctx)
+	if deadline, _ := cp.abortCtx.Deadline(); time.Until(deadline) < time.Minute {
+		t.Errorf("abort should be bounded by the timeout of the provisioner, got: %s", deadline)
+	}
+
+	if ok, err := Provision(cp).(Expecter).Expect(); !ok || err != nil || cp.expectCtx == ctx {
+		t.Errorf("expectation without context should use a background one, got: %t %s", ok, err)
+	}
+}
+
+type contextVerifier struct {
+	*MockProvisioner
+	verifyCtx context.Context
+}
+
+func (cv *contextVerifier) Verify() error { panic("VerifyContext should be preferred") }
+
+func (cv *contextVerifier) VerifyContext(ctx context.Context) error {
+	cv.verifyCtx = ctx
+	return ctx.Err()
+}
+
+func TestProvisionerVerifyContext(t *testing.T) {
+	cv := &contextVerifier{MockProvisioner: NewMockProvisioner()}
+	ctx, cancel := context.WithCancel(context.WithValue(context.Background(), ctxKey{}, "run"))
+	cancel()
+	err := Provision(cv).Start(ctx)
+	if !errors.Is(err, ErrVerify) || !errors.Is(err, context.Canceled) || cv.verifyCtx != ctx {
+		t.Errorf("verification should get the context of the run, got: %v", err)
+	}
+	if !cv.abortCalled {
+		t.Errorf("abort function should have been called")
+	}
+}
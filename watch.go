@@ -0,0 +1,265 @@
+package antfarm
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+type (
+	WatchOpts struct {
+		Debounce time.Duration       // quiet period awaited after a change before running, defaults to 100ms
+		Interval time.Duration       // period of the polling fallback, also used while an input directory is missing, defaults to 1s
+		Poll     bool                // poll even if the system can notify the changes
+		Done     func(Report, error) // called after each run, the canceled ones included
+	}
+
+	// watcher signals that something may have changed under the watched patterns
+	watcher interface {
+		changes() <-chan bool
+		close()
+	}
+
+	poller struct {
+		patterns []string
+		files    map[string]os.FileInfo
+		ch       chan bool
+		stop     chan bool
+	}
+
+	// watched is the outcome of a run started by Watch
+	watched struct {
+		tasks  []string
+		report Report
+		err    error
+	}
+)
+
+// root returns the deepest directory of the pattern free of wildcards, and if its subdirectories must be watched as well.
+// A pattern without wildcards naming a directory is watched as a whole, as its files are hashed.
+func root(pattern string) (string, bool) {
+	i := strings.IndexAny(pattern, "*?[")
+	if i < 0 {
+		if info, err := os.Stat(pattern); err == nil && info.IsDir() {
+			return filepath.Clean(pattern), true
+		}
+		return filepath.Dir(pattern), false
+	}
+	rest := pattern[i:]
+	return filepath.Dir(pattern[:i] + "x"), strings.Contains(rest, "**") || strings.ContainsRune(rest, filepath.Separator)
+}
+
+// signal a change without blocking, one pending change is enough
+func changed(ch chan bool) {
+	select {
+	case ch <- true:
+	default:
+	}
+}
+
+func newPoller(patterns []string, interval time.Duration) *poller {
+	p := &poller{patterns: patterns, ch: make(chan bool, 1), stop: make(chan bool)}
+	p.files = p.scan()
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+			case <-p.stop:
+				return
+			}
+			if files := p.scan(); !p.same(files) {
+				p.files = files
+				changed(p.ch)
+			}
+		}
+	}()
+	return p
+}
+
+func (p *poller) scan() map[string]os.FileInfo {
+	files := map[string]os.FileInfo{}
+	for _, pattern := range p.patterns {
+		matches, _ := glob(pattern)
+		for _, match := range matches {
+			filepath.Walk(match, func(path string, info os.FileInfo, err error) error {
+				if err == nil && !info.IsDir() {
+					files[path] = info
+				}
+				return nil
+			})
+		}
+	}
+	return files
+}
+
+func (p *poller) same(files map[string]os.FileInfo) bool {
+	if len(files) != len(p.files) {
+		return false
+	}
+	for path, info := range files {
+		old, ok := p.files[path]
+		if !ok || old.Size() != info.Size() || !old.ModTime().Equal(info.ModTime()) {
+			return false
+		}
+	}
+	return true
+}
+
+func (p *poller) changes() <-chan bool { return p.ch }
+func (p *poller) close()               { close(p.stop) }
+
+func (opts WatchOpts) watcher(patterns []string) watcher {
+	if !opts.Poll {
+		if w, err := notify(patterns); err == nil {
+			return w
+		}
+	}
+	return newPoller(patterns, opts.Interval)
+}
+
+// subgraph keeps the pending tasks and the dependencies which did not succeed yet, the other dependencies are dropped
+func (runner Runner) subgraph(pending, succeeded map[string]bool) (Runner, []string) {
+	var tasks []string
+	for name := range pending {
+		tasks = append(tasks, name)
+	}
+	sub := runner
+	sub.nodes = map[string]Node{}
+	for len(tasks) > 0 {
+		name := tasks[0]
+		tasks = tasks[1:]
+		if _, ok := sub.nodes[name]; ok {
+			continue
+		}
+		node := runner.nodes[name]
+		sub.nodes[name] = node
+		for _, dep := range node.Deps {
+			if !succeeded[dep] {
+				tasks = append(tasks, dep)
+			}
+		}
+	}
+
+	for name, node := range sub.nodes {
+		var deps []string
+		for _, dep := range node.Deps {
+			if _, ok := sub.nodes[dep]; ok {
+				deps = append(deps, dep)
+			}
+		}
+		node.Deps = deps
+		sub.nodes[name] = node
+		tasks = append(tasks, name)
+	}
+	sort.Strings(tasks)
+	return sub, tasks
+}
+
+// rerun runs the pending tasks in the background, see subgraph
+func (runner Runner) rerun(ctx context.Context, pending, succeeded map[string]bool) (context.CancelFunc, chan watched) {
+	sub, tasks := runner.subgraph(pending, succeeded)
+	ctx, cancel := context.WithCancel(ctx)
+	done := make(chan watched, 1)
+	go func() {
+		report, err := sub.ExecuteContext(ctx, tasks...)
+		done <- watched{tasks, report, err}
+	}()
+	return cancel, done
+}
+
+// Watch runs the targets, then runs again the tasks whose inputs changed along with their dependents, until ctx is canceled.
+// A change happening during a run cancels it, the tasks which did not complete are part of the next run.
+// Signals are left to the caller, cancel ctx to stop watching.
+func (runner Runner) Watch(ctx context.Context, targets []string, options ...func(*WatchOpts)) error {
+	opts := WatchOpts{Debounce: 100 * time.Millisecond, Interval: time.Second}
+	for _, option := range options {
+		option(&opts)
+	}
+
+	resolved, err := runner.Resolve(Node{Deps: targets})
+	if err != nil {
+		return err
+	}
+	resolved = resolved[:len(resolved)-1] // root is last
+	var patterns []string
+	inputs, dependents := map[string]map[string]string{}, map[string][]string{}
+	for _, name := range resolved {
+		node := runner.nodes[name]
+		for _, dep := range node.Deps {
+			dependents[dep] = append(dependents[dep], name)
+		}
+		patterns = append(patterns, node.Inputs...)
+		inputs[name], _ = hashFiles(node.Inputs)
+	}
+	w := opts.watcher(patterns)
+	defer w.close()
+	runner.Signal.Ignore = true // the runs are canceled through ctx
+
+	var (
+		debounce    <-chan time.Time
+		cancel      context.CancelFunc
+		done        chan watched
+		interrupted bool // the current run was canceled because of a change
+	)
+	pending, succeeded := map[string]bool{}, map[string]bool{}
+	for _, name := range resolved {
+		pending[name] = true
+	}
+	for {
+		if len(pending) > 0 && done == nil && debounce == nil {
+			cancel, done = runner.rerun(ctx, pending, succeeded)
+			pending = map[string]bool{}
+		}
+
+		select {
+		case <-ctx.Done():
+			if done != nil {
+				<-done
+				cancel()
+			}
+			return ctx.Err()
+		case <-w.changes():
+			debounce = time.After(opts.Debounce)
+		case <-debounce:
+			debounce = nil
+			var affected []string
+			for _, name := range resolved { // compare the hashes, the files may only have been touched
+				if hashes, _ := hashFiles(runner.nodes[name].Inputs); !equal(hashes, inputs[name]) {
+					inputs[name] = hashes
+					affected = append(affected, name)
+				}
+			}
+			for len(affected) > 0 {
+				name := affected[0]
+				if affected = affected[1:]; !pending[name] {
+					pending[name] = true
+					affected = append(affected, dependents[name]...)
+				}
+			}
+			if len(pending) > 0 && done != nil && !interrupted {
+				interrupted = true
+				cancel()
+			}
+		case result := <-done:
+			cancel()
+			for _, name := range result.tasks {
+				if in(name, result.report.Succeeded) {
+					succeeded[name] = true
+					continue
+				}
+				if delete(succeeded, name); interrupted {
+					pending[name] = true
+				}
+			}
+			done, interrupted = nil, false
+			if opts.Done != nil {
+				opts.Done(result.report, result.err)
+			}
+		}
+	}
+}
@@ -0,0 +1,91 @@
+package antfarm
+
+import (
+	"os"
+	"path/filepath"
+	"syscall"
+	"unsafe"
+)
+
+const inotifyMask = syscall.IN_CLOSE_WRITE | syscall.IN_MODIFY | syscall.IN_CREATE | syscall.IN_DELETE |
+	syscall.IN_MOVED_FROM | syscall.IN_MOVED_TO | syscall.IN_DELETE_SELF | syscall.IN_MOVE_SELF
+
+type inotify struct {
+	fd        int
+	file      *os.File         // reads through the runtime poller, closing it unblocks the reader
+	recursive map[int32]string // directories whose new subdirectories are watched too
+	ch        chan bool
+}
+
+// notify watches the directories the patterns could match in, the descriptor is non blocking to be closable while read.
+// A directory which does not exist yet can not be watched, the error lets the caller fall back to polling.
+func notify(patterns []string) (watcher, error) {
+	fd, err := syscall.InotifyInit1(syscall.IN_CLOEXEC | syscall.IN_NONBLOCK)
+	if err != nil {
+		return nil, err
+	}
+	w := &inotify{fd, os.NewFile(uintptr(fd), "inotify"), map[int32]string{}, make(chan bool, 1)}
+	for _, pattern := range patterns {
+		dir, recursive := root(pattern)
+		err := w.add(dir, recursive)
+		if err == nil && recursive {
+			err = filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+				if err == nil && info.IsDir() && path != dir {
+					return w.add(path, true)
+				}
+				return nil
+			})
+		}
+		if err != nil {
+			w.close()
+			return nil, err
+		}
+	}
+	go w.read()
+	return w, nil
+}
+
+func (w *inotify) add(dir string, recursive bool) error {
+	wd, err := syscall.InotifyAddWatch(w.fd, dir, inotifyMask)
+	if err != nil {
+		return os.NewSyscallError("inotify_add_watch", err)
+	}
+	if recursive {
+		w.recursive[int32(wd)] = dir
+	}
+	return nil
+}
+
+func (w *inotify) read() {
+	buf := make([]byte, 64*(syscall.SizeofInotifyEvent+syscall.NAME_MAX+1))
+	for {
+		n, err := w.file.Read(buf)
+		if err != nil { // closed
+			return
+		}
+		for offset := 0; offset+syscall.SizeofInotifyEvent <= n; {
+			event := (*syscall.InotifyEvent)(unsafe.Pointer(&buf[offset]))
+			name := buf[offset+syscall.SizeofInotifyEvent : offset+syscall.SizeofInotifyEvent+int(event.Len)]
+			offset += syscall.SizeofInotifyEvent + int(event.Len)
+
+			// new directories under a recursive root are watched as well
+			if dir, ok := w.recursive[event.Wd]; ok && event.Mask&syscall.IN_ISDIR != 0 && event.Mask&(syscall.IN_CREATE|syscall.IN_MOVED_TO) != 0 {
+				w.add(filepath.Join(dir, string(name[:clen(name)])), true)
+			}
+		}
+		changed(w.ch)
+	}
+}
+
+// clen is the length of the name, padded with zeros
+func clen(name []byte) int {
+	for i, b := range name {
+		if b == 0 {
+			return i
+		}
+	}
+	return len(name)
+}
+
+func (w *inotify) changes() <-chan bool { return w.ch }
+func (w *inotify) close()               { w.file.Close() }
@@ -0,0 +1,9 @@
+//go:build !linux
+// +build !linux
+
+package antfarm
+
+import "errors"
+
+// notify is only implemented with inotify, other systems poll
+func notify(_ []string) (watcher, error) { return nil, errors.New("file notifications not supported") }
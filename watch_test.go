@@ -0,0 +1,177 @@
+package antfarm
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+type counter struct {
+	sync.Mutex
+	counts map[string]int
+}
+
+func (c *counter) NewTask(name string) Task {
+	return TaskFunc(func(_ context.Context) error {
+		c.Lock()
+		defer c.Unlock()
+		c.counts[name]++
+		return nil
+	})
+}
+
+func (c *counter) expect(t *testing.T, expected map[string]int) {
+	t.Helper()
+	c.Lock()
+	defer c.Unlock()
+	for name, count := range expected {
+		if c.counts[name] != count {
+			t.Errorf("unexpected runs, got: %v, expected: %v", c.counts, expected)
+			return
+		}
+	}
+}
+
+// helperWatch starts watching in the background, the returned function stops it
+func helperWatch(t *testing.T, runner Runner, poll bool, targets ...string) (chan error, func()) {
+	t.Helper()
+	runs := make(chan error)
+	ctx, cancel := context.WithCancel(context.Background())
+	stopped := make(chan error)
+	go func() {
+		stopped <- runner.Watch(ctx, targets, func(opts *WatchOpts) {
+			opts.Debounce, opts.Interval, opts.Poll = 20*time.Millisecond, 10*time.Millisecond, poll
+			opts.Done = func(_ Report, err error) { runs <- err }
+		})
+	}()
+	return runs, func() {
+		cancel()
+		if err := <-stopped; err != context.Canceled {
+			t.Errorf("unexpected error, got: %v, expected: %s", err, context.Canceled)
+		}
+	}
+}
+
+func helperRun(t *testing.T, runs chan error) error {
+	t.Helper()
+	select {
+	case err := <-runs:
+		return err
+	case <-time.After(5 * time.Second):
+		t.Fatal("no run triggered")
+	}
+	return nil
+}
+
+func TestWatch(t *testing.T) {
+	for _, poll := range []bool{true, false} {
+		dir := helperDir(t)
+		a, b := filepath.Join(dir, "a.txt"), filepath.Join(dir, "sub", "b.txt")
+		helperWrite(t, a, "a")
+		helperWrite(t, b, "b")
+		c := &counter{counts: map[string]int{}}
+		runner := Runner{State: filepath.Join(dir, "state.json")}.
+			Add(Node{Name: "a", Task: c.NewTask("a"), Inputs: []string{filepath.Join(dir, "*.txt")}}).
+			Add(Node{Name: "b", Task: c.NewTask("b"), Inputs: []string{filepath.Join(dir, "**", "b.txt")}}).
+			Add(Node{Name: "c", Task: c.NewTask("c"), Deps: []string{"a", "b"}})
+
+		runs, stop := helperWatch(t, runner, poll, "c")
+		unexpectedErr(t, helperRun(t, runs), nil)
+		c.expect(t, map[string]int{"a": 1, "b": 1, "c": 1})
+
+		helperWrite(t, a, "aa")
+		unexpectedErr(t, helperRun(t, runs), nil)
+		c.expect(t, map[string]int{"a": 2, "b": 1, "c": 2})
+
+		helperWrite(t, b, "bb")
+		unexpectedErr(t, helperRun(t, runs), nil)
+		c.expect(t, map[string]int{"a": 2, "b": 2, "c": 3})
+		stop()
+	}
+}
+
+func TestWatchMissingDir(t *testing.T) {
+	dir := helperDir(t)
+	gen := filepath.Join(dir, "gen")
+	c := &counter{counts: map[string]int{}}
+	runner := Runner{}.Add(Node{Name: "a", Task: c.NewTask("a"), Inputs: []string{filepath.Join(gen, "*.txt")}})
+
+	runs, stop := helperWatch(t, runner, false, "a")
+	defer stop()
+	unexpectedErr(t, helperRun(t, runs), nil)
+	helperWrite(t, filepath.Join(gen, "x.txt"), "x") // the directory appears once watching
+	unexpectedErr(t, helperRun(t, runs), nil)
+	c.expect(t, map[string]int{"a": 2})
+}
+
+func TestWatchDirInput(t *testing.T) {
+	dir := helperDir(t)
+	src := filepath.Join(dir, "src")
+	helperWrite(t, filepath.Join(src, "deep", "a.go"), "a")
+	c := &counter{counts: map[string]int{}}
+	state := filepath.Join(helperDir(t), "state.json") // outside of the watched directory, not to notify its own writes
+	runner := Runner{State: state}.
+		Add(Node{Name: "a", Task: c.NewTask("a"), Inputs: []string{src}})
+
+	runs, stop := helperWatch(t, runner, false, "a")
+	defer stop()
+	unexpectedErr(t, helperRun(t, runs), nil)
+	helperWrite(t, filepath.Join(src, "deep", "a.go"), "aa")
+	unexpectedErr(t, helperRun(t, runs), nil)
+	c.expect(t, map[string]int{"a": 2})
+}
+
+func TestWatchCancelRun(t *testing.T) {
+	dir := helperDir(t)
+	a := filepath.Join(dir, "a.txt")
+	helperWrite(t, a, "a")
+	started, first := make(chan bool), true
+	runner := Runner{}.
+		Add(Node{Name: "a", Task: TaskFunc(func(ctx context.Context) error {
+			if !first {
+				return nil
+			}
+			first = false
+			close(started)
+			<-ctx.Done()
+			return ctx.Err()
+		}), Inputs: []string{a}})
+
+	runs, stop := helperWatch(t, runner, true, "a")
+	defer stop()
+	<-started
+	helperWrite(t, a, "aa")
+	if err := helperRun(t, runs); !errors.Is(err, context.Canceled) {
+		t.Errorf("unexpected error, got: %v, expected: %s", err, context.Canceled)
+	}
+	unexpectedErr(t, helperRun(t, runs), nil) // the canceled task runs again
+}
+
+func TestWatchDependencyErr(t *testing.T) {
+	err := Runner{}.Task("foo", noop(), "bar").Watch(context.Background(), []string{"foo"})
+	if !errors.Is(err, ErrDepNotFound) {
+		t.Errorf("unexpected error type, got: %s, expected: %s", err, ErrDepNotFound)
+	}
+}
+
+func TestWatchRoot(t *testing.T) {
+	for pattern, expected := range map[string]struct {
+		dir       string
+		recursive bool
+	}{
+		"a.txt":         {".", false},
+		".":             {".", true},
+		"src/*.go":      {"src", false},
+		"src/**/*.go":   {"src", true},
+		"src/a*/b.go":   {"src", true},
+		"**/*.go":       {".", true},
+		"/abs/dir/file": {"/abs/dir", false},
+	} {
+		if dir, recursive := root(pattern); dir != expected.dir || recursive != expected.recursive {
+			t.Errorf("unexpected root for %s, got: %s %t, expected: %v", pattern, dir, recursive, expected)
+		}
+	}
+}